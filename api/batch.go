@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+// MaxBatchKeys limits the number of locks taken or released in a single batch
+const MaxBatchKeys = 64
+
+type LockBatchCreateRequest struct {
+	Keys []string `json:"keys"`
+	Ttl  int64    `json:"ttl"`
+}
+
+type LockBatchReleaseRequest struct {
+	Generations map[string]int64 `json:"generations"`
+}
+
+type LockBatchResponse struct {
+	Generations map[string]int64 `json:"generations"`
+}
+
+func (s *Server) handleLockBatchCreate(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body LockBatchCreateRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if len(body.Keys) == 0 || len(body.Keys) > MaxBatchKeys {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	keys := make([]string, 0, len(body.Keys))
+	for _, k := range body.Keys {
+		key, ok := s.lockerKey(k)
+		if !ok {
+			return http.StatusUnprocessableEntity, nil
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i, key := range keys {
+		// a key can not be locked along with itself or a key above or below it
+		for _, k := range keys[:i] {
+			if relatedKeys(k, key) {
+				return http.StatusUnprocessableEntity, nil
+			}
+		}
+
+		if !s.supportsKey(key) {
+			return renderError(locker.ErrNotSupported)
+		}
+	}
+
+	ttl := time.Second * time.Duration(body.Ttl)
+	expires := locker.NewMetadata(ttl).Expires
+
+	generations := make(map[string]int64, len(keys))
+	previous := make(map[string]int64, len(keys))
+
+	// locks are taken in sorted order so that concurrent batches with
+	// overlapping keys can not end up each holding a part of the other,
+	// on failure the locks taken so far are released. Nothing is published
+	// until every lock is taken, so event subscribers never see a batch
+	// which is rolled back
+	for _, key := range keys {
+		var gen, prev int64
+		if s.waiters.queued(key) > 0 {
+			// do not jump the queue of waiting requests
+			err = locker.ErrLockTaken
+		} else {
+			gen, prev, err = s.take(key, ttl, s.locker.Lock)
+		}
+
+		if err != nil {
+			for k, g := range generations {
+				if s.locker.Release(k, g) == nil {
+					s.waiters.notify(k)
+				}
+			}
+			return renderError(err)
+		}
+
+		generations[key] = gen
+		previous[key] = prev
+	}
+
+	for _, key := range keys {
+		s.acquired(key, generations[key], previous[key], expires)
+	}
+
+	res := &LockBatchResponse{
+		Generations: make(map[string]int64, len(keys)),
+	}
+
+	for key, gen := range generations {
+		res.Generations[s.apiKey(key)] = gen
+	}
+
+	return renderJSON(w, r, res)
+}
+
+func (s *Server) handleLockBatchRelease(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body LockBatchReleaseRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if len(body.Generations) == 0 || len(body.Generations) > MaxBatchKeys {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	generations := make(map[string]int64, len(body.Generations))
+	for k, gen := range body.Generations {
+		key, ok := s.lockerKey(k)
+		if !ok || gen < 1 {
+			return http.StatusUnprocessableEntity, nil
+		}
+		generations[key] = gen
+	}
+
+	// release every lock even if some of them fail,
+	// the first failure is reported
+	var failure error
+	for key, gen := range generations {
+		err = s.locker.Release(key, gen)
+		if err != nil {
+			if failure == nil {
+				failure = err
+			}
+			continue
+		}
+
+		s.released(key, gen)
+	}
+
+	if failure != nil {
+		return renderError(failure)
+	}
+
+	return http.StatusOK, nil
+}
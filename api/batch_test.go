@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+func TestBatchAcquiresAllLocks(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		body := strings.NewReader(`{"keys":["db.users","db.orders","cache.sessions"],"ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks/batch", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var resp LockBatchResponse
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		if err != nil {
+			t.Errorf("could not decode response: %v", err)
+		}
+
+		if len(resp.Generations) != 3 {
+			t.Errorf("expected 3 generations, received %v", resp.Generations)
+		}
+
+		for key, gn := range resp.Generations {
+			_, err = server.locker.Lock(key, 300*time.Second)
+			if !errors.Is(err, locker.ErrLockTaken) {
+				t.Errorf("expected lock %s to be taken", key)
+			}
+
+			if gn == 0 {
+				t.Errorf("invalid generation returned for %s", key)
+			}
+		}
+
+		data, _ := json.Marshal(&LockBatchReleaseRequest{Generations: resp.Generations})
+		req = httptest.NewRequest("POST", "/api/locks/batch/release", strings.NewReader(string(data)))
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		for key := range resp.Generations {
+			_, _, err = server.locker.Expired(key)
+			if !errors.Is(err, locker.ErrLockNotExist) {
+				t.Errorf("expected lock %s to be released", key)
+			}
+		}
+	})
+}
+
+func TestBatchLeavesNoPartialLocks(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		_, err := server.locker.Lock("db.orders", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		body := strings.NewReader(`{"keys":["db.users","db.orders","cache.sessions"],"ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks/batch", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+
+		for _, key := range []string{"db.users", "cache.sessions"} {
+			_, _, err = server.locker.Expired(key)
+			if !errors.Is(err, locker.ErrLockNotExist) {
+				t.Errorf("expected lock %s to not be held", key)
+			}
+		}
+	})
+}
+
+func TestBatchPublishesNothingOnFailure(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		_, err := server.locker.Lock("db.orders", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		sub := server.events.subscribe("")
+		defer server.events.unsubscribe(sub)
+
+		body := strings.NewReader(`{"keys":["cache.sessions","db.orders","db.users"],"ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks/batch", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+
+		if len(sub.events) != 0 {
+			t.Errorf("expected no events, received %+v", <-sub.events)
+		}
+
+		body = strings.NewReader(`{"keys":["cache.sessions","db.users"],"ttl":300}`)
+		req = httptest.NewRequest("POST", "/api/locks/batch", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		if len(sub.events) != 2 {
+			t.Errorf("expected 2 events, received %d", len(sub.events))
+		}
+	})
+}
+
+func TestBatchRejectsDuplicateKeys(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		body := strings.NewReader(`{"keys":["db.users","db.users"],"ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks/batch", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected status code %d, received %d", http.StatusUnprocessableEntity, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestBatchRejectsNestedKeys(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		body := strings.NewReader(`{"keys":["db/users","db.orders","db"],"ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks/batch", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected status code %d, received %d", http.StatusUnprocessableEntity, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestBatchSplitsKeysByDots(t *testing.T) {
+	server := NewServer(locker.NewMemLocker(), WithDotKeyDelimiter())
+
+	body := strings.NewReader(`{"keys":["db.users","db"],"ttl":300}`)
+	req := httptest.NewRequest("POST", "/api/locks/batch", body)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected status code %d, received %d", http.StatusUnprocessableEntity, w.Result().StatusCode)
+	}
+
+	body = strings.NewReader(`{"keys":["db.users","db.orders"],"ttl":300}`)
+	req = httptest.NewRequest("POST", "/api/locks/batch", body)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var resp LockBatchResponse
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil || resp.Generations["db.users"] == 0 || resp.Generations["db.orders"] == 0 {
+		t.Fatalf("expected generations of the dotted keys, received %v %v", resp.Generations, err)
+	}
+
+	data, _ := json.Marshal(&LockBatchReleaseRequest{Generations: resp.Generations})
+	req = httptest.NewRequest("POST", "/api/locks/batch/release", strings.NewReader(string(data)))
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+	}
+
+	_, err = server.locker.Get("db/users")
+	if !errors.Is(err, locker.ErrLockNotExist) {
+		t.Errorf("expected lock db/users to be released")
+	}
+}
+
+func TestBatchReleaseReportsFailure(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.Lock("db.users", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		body := strings.NewReader(fmt.Sprintf(`{"generations":{"db.users":%d,"db.orders":%d}}`, gn, gn))
+		req := httptest.NewRequest("POST", "/api/locks/batch/release", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+
+		_, _, err = server.locker.Expired("db.users")
+		if !errors.Is(err, locker.ErrLockNotExist) {
+			t.Errorf("expected lock to be released")
+		}
+	})
+}
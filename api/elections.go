@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+// MaxElectionValueLength limits the length of the values candidates campaign with
+const MaxElectionValueLength = 1024
+
+type ElectionCampaignRequest struct {
+	Identity string `json:"identity"`
+	Value    string `json:"value"`
+	Ttl      int64  `json:"ttl"`
+	Wait     int64  `json:"wait"`
+}
+
+type ElectionRefreshRequest struct {
+	Generation int64 `json:"generation"`
+}
+
+type ElectionResponse struct {
+	Generation int64 `json:"generation"`
+}
+
+// ElectionLeaderResponse describes the leader, remaining is the number of
+// seconds until the leadership expires or -1 if it never expires
+type ElectionLeaderResponse struct {
+	Identity   string     `json:"identity"`
+	Value      string     `json:"value"`
+	Generation int64      `json:"generation"`
+	Remaining  int64      `json:"remaining"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// ElectionObserveResponse tells whether the leadership changed from the
+// observed generation, leader is omitted if the election has no leader
+type ElectionObserveResponse struct {
+	Changed bool                    `json:"changed"`
+	Leader  *ElectionLeaderResponse `json:"leader,omitempty"`
+}
+
+// candidate owns the election lock, so that the same candidate
+// campaigning again keeps its leadership
+type candidate struct {
+	Identity string `json:"identity"`
+	Value    string `json:"value"`
+}
+
+// electionKey returns the internal lock key held by the leader of the election
+func electionKey(name string) string {
+	return locker.InternalKeyPrefix + "election." + name
+}
+
+func validElectionName(name string) bool {
+	return validKey(name) && !isHierarchical(name)
+}
+
+func (s *Server) handleElectionCampaign(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body ElectionCampaignRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	vars := mux.Vars(r)
+	if !validElectionName(vars["name"]) || body.Wait < 0 {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	if body.Identity == "" || len(body.Identity) > MaxOwnerLength || len(body.Value) > MaxElectionValueLength {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	reentrant, ok := s.locker.(locker.ReentrantLocker)
+	if !ok {
+		return renderError(locker.ErrNotSupported)
+	}
+
+	owner, err := json.Marshal(candidate{Identity: body.Identity, Value: body.Value})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	lock := func(key string, ttl time.Duration) (int64, error) {
+		return reentrant.LockOwned(key, string(owner), ttl)
+	}
+
+	key := electionKey(vars["name"])
+	ttl := time.Second * time.Duration(body.Ttl)
+
+	// the leader campaigning again keeps its leadership without
+	// queueing up behind the candidates waiting for it to resign
+	gen, err := s.lock(r.Context(), key, ttl, time.Second*time.Duration(body.Wait), string(owner), lock)
+	if err != nil {
+		return renderError(err)
+	}
+
+	res := &ElectionResponse{
+		Generation: gen,
+	}
+
+	return renderJSON(w, r, res)
+}
+
+func (s *Server) handleElectionRefresh(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body ElectionRefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	vars := mux.Vars(r)
+	if body.Generation < 1 || !validElectionName(vars["name"]) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	key := electionKey(vars["name"])
+	gen, err := s.locker.Refresh(key, body.Generation)
+	if err != nil {
+		return renderError(err)
+	}
+
+	s.refreshed(key, gen, body.Generation)
+
+	res := &ElectionResponse{
+		Generation: gen,
+	}
+
+	return renderJSON(w, r, res)
+}
+
+func (s *Server) handleElectionResign(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body ElectionRefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	vars := mux.Vars(r)
+	if body.Generation < 1 || !validElectionName(vars["name"]) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	key := electionKey(vars["name"])
+	info, err := s.locker.Get(key)
+	if err != nil {
+		return renderError(err)
+	}
+
+	if info.Holders[0].Generation != body.Generation {
+		return renderError(locker.ErrGenNumberMismatch)
+	}
+
+	// the lock is held once per campaign of the leader, resigning gives up all of them
+	err = s.releaseHolds(key, info.Holders[0])
+	if err != nil {
+		return renderError(err)
+	}
+
+	s.released(key, body.Generation)
+
+	return http.StatusOK, nil
+}
+
+func (s *Server) handleElectionLeader(w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	if !validElectionName(vars["name"]) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	info, _, err := s.lockState(electionKey(vars["name"]), 0)
+	if err != nil {
+		return renderError(err)
+	}
+
+	if info == nil {
+		return renderError(locker.ErrLockNotExist)
+	}
+
+	leader, err := newElectionLeaderResponse(info, time.Now())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return renderJSON(w, r, leader)
+}
+
+func (s *Server) handleElectionObserve(w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	if !validElectionName(vars["name"]) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	generation, wait, ok := parseWatchQuery(r)
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	info, changed, err := s.watchLock(r.Context(), electionKey(vars["name"]), generation, time.Second*time.Duration(wait))
+	if err != nil {
+		return renderError(err)
+	}
+
+	res := &ElectionObserveResponse{
+		Changed: changed,
+	}
+
+	if info != nil {
+		res.Leader, err = newElectionLeaderResponse(info, time.Now())
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	return renderJSON(w, r, res)
+}
+
+func newElectionLeaderResponse(info *locker.LockInfo, now time.Time) (*ElectionLeaderResponse, error) {
+	h := info.Holders[0]
+
+	var c candidate
+	if err := json.Unmarshal([]byte(h.Owner), &c); err != nil {
+		return nil, err
+	}
+
+	res := &ElectionLeaderResponse{
+		Identity:   c.Identity,
+		Value:      c.Value,
+		Generation: h.Generation,
+		Remaining:  -1,
+	}
+
+	if h.Expires != -1 {
+		expires := time.Unix(h.Expires, 0).UTC()
+		res.ExpiresAt = &expires
+
+		res.Remaining = h.Expires - now.Unix()
+		if res.Remaining < 0 {
+			res.Remaining = 0
+		}
+	}
+
+	return res, nil
+}
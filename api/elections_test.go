@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func campaign(t *testing.T, server *Server, name string, body string) (*ElectionResponse, int) {
+	req := httptest.NewRequest("POST", "/api/elections/"+name, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		return nil, w.Result().StatusCode
+	}
+
+	var resp ElectionResponse
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Errorf("could not decode response: %v", err)
+	}
+
+	return &resp, http.StatusOK
+}
+
+func getLeader(t *testing.T, server *Server, name string) (*ElectionLeaderResponse, int) {
+	req := httptest.NewRequest("GET", "/api/elections/"+name, nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		return nil, w.Result().StatusCode
+	}
+
+	var resp ElectionLeaderResponse
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Errorf("could not decode response: %v", err)
+	}
+
+	return &resp, http.StatusOK
+}
+
+func resign(server *Server, name string, generation int64) int {
+	body := strings.NewReader(fmt.Sprintf(`{"generation":%d}`, generation))
+	req := httptest.NewRequest("DELETE", "/api/elections/"+name, body)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	return w.Result().StatusCode
+}
+
+func TestElectionElectsSingleLeader(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		first, status := campaign(t, server, "test", `{"identity":"node-1","value":"10.0.0.1:8080","ttl":300}`)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		_, status = campaign(t, server, "test", `{"identity":"node-2","value":"10.0.0.2:8080","ttl":300}`)
+		if status != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, status)
+		}
+
+		leader, status := getLeader(t, server, "test")
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		if leader.Identity != "node-1" || leader.Value != "10.0.0.1:8080" || leader.Generation != first.Generation {
+			t.Errorf("unexpected leader %+v", leader)
+		}
+
+		// elections do not share keys with locks
+		body := strings.NewReader(`{"key":"test","ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestElectionLeaderCampaignsAgain(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		first, _ := campaign(t, server, "test", `{"identity":"node-1","ttl":300}`)
+
+		second, status := campaign(t, server, "test", `{"identity":"node-1","ttl":300}`)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		if second.Generation != first.Generation {
+			t.Errorf("expected generation %d, received %d", first.Generation, second.Generation)
+		}
+
+		// resigning once gives up the leadership taken by both campaigns
+		if status := resign(server, "test", first.Generation); status != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		if _, status := getLeader(t, server, "test"); status != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, status)
+		}
+	})
+}
+
+func TestElectionCandidateWaitsForResign(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		first, _ := campaign(t, server, "test", `{"identity":"node-1","ttl":300}`)
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			resign(server, "test", first.Generation)
+		}()
+
+		_, status := campaign(t, server, "test", `{"identity":"node-2","ttl":300,"wait":10}`)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		leader, _ := getLeader(t, server, "test")
+		if leader == nil || leader.Identity != "node-2" {
+			t.Errorf("expected node-2 to lead, received %+v", leader)
+		}
+	})
+}
+
+func TestElectionExpiredLeaderIsReplaced(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		campaign(t, server, "test", `{"identity":"node-1","ttl":1}`)
+
+		time.Sleep(1100 * time.Millisecond)
+
+		if _, status := getLeader(t, server, "test"); status != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, status)
+		}
+
+		_, status := campaign(t, server, "test", `{"identity":"node-2","ttl":300}`)
+		if status != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, status)
+		}
+	})
+}
+
+func TestElectionObserveReturnsOnResign(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		first, _ := campaign(t, server, "test", `{"identity":"node-1","ttl":300}`)
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			resign(server, "test", first.Generation)
+		}()
+
+		start := time.Now()
+
+		url := fmt.Sprintf("/api/elections/test/observe?generation=%d&wait=10", first.Generation)
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var resp ElectionObserveResponse
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		if err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+
+		if !resp.Changed || resp.Leader != nil {
+			t.Errorf("expected no leader, received %+v", resp)
+		}
+
+		if elapsed := time.Since(start); elapsed >= waitPollInterval {
+			t.Errorf("expected resign to wake up the observer, waited %v", elapsed)
+		}
+	})
+}
+
+func TestElectionRejectsInvalidCampaign(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, body := range []string{
+			`{"ttl":300}`,
+			fmt.Sprintf(`{"identity":"%s","ttl":300}`, strings.Repeat("a", MaxOwnerLength+1)),
+			fmt.Sprintf(`{"identity":"node-1","value":"%s","ttl":300}`, strings.Repeat("a", MaxElectionValueLength+1)),
+			`{"identity":"node-1","ttl":300,"wait":-1}`,
+		} {
+			if _, status := campaign(t, server, "test", body); status != http.StatusUnprocessableEntity {
+				t.Errorf("%s: expected status code %d, received %d", body, http.StatusUnprocessableEntity, status)
+			}
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+const (
+	EventAcquire  = "acquire"
+	EventRefresh  = "refresh"
+	EventRelease  = "release"
+	EventExpire   = "expire"
+	EventTakeover = "takeover"
+)
+
+// eventBufferSize is the number of events buffered per subscriber,
+// subscribers falling further behind are disconnected
+const eventBufferSize = 256
+
+// eventKeepAliveInterval is how often an idle event stream
+// is written to, so that proxies do not close it
+const eventKeepAliveInterval = 15 * time.Second
+
+var errEventsDropped = errors.New("event subscriber fell behind")
+
+// Event is a change of a lock's state, Previous is the generation
+// number the lock had before a refresh or a takeover
+type Event struct {
+	Type       string    `json:"type"`
+	Key        string    `json:"key"`
+	Generation int64     `json:"generation"`
+	Previous   int64     `json:"previous,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// subscription receives the events of the keys starting with prefix
+type subscription struct {
+	prefix string
+	events chan Event
+}
+
+// hold is a hold of a lock watched for expiry
+type hold struct {
+	key        string
+	generation int64
+}
+
+// eventBus fans the lock events out to every subscription and keeps
+// the timers of the holds watched for expiry
+type eventBus struct {
+	mu       sync.Mutex
+	subs     map[*subscription]struct{}
+	watching map[hold]*time.Timer
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subs:     make(map[*subscription]struct{}),
+		watching: make(map[hold]*time.Timer),
+	}
+}
+
+// watch calls fn once d passes unless the hold is unwatched before,
+// a hold which is already watched keeps its timer
+func (b *eventBus) watch(h hold, d time.Duration, fn func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.watching[h]; ok {
+		return
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(d, func() {
+		b.mu.Lock()
+		current := b.watching[h] == t
+		if current {
+			delete(b.watching, h)
+		}
+		b.mu.Unlock()
+
+		if current {
+			fn()
+		}
+	})
+	b.watching[h] = t
+}
+
+// unwatch stops the timer of the hold
+func (b *eventBus) unwatch(h hold) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t, ok := b.watching[h]; ok {
+		t.Stop()
+		delete(b.watching, h)
+	}
+}
+
+func (b *eventBus) subscribe(prefix string) *subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscription{
+		prefix: prefix,
+		events: make(chan Event, eventBufferSize),
+	}
+	b.subs[sub] = struct{}{}
+
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// publish never blocks, a subscriber with a full buffer is
+// dropped instead of holding up the lock requests
+func (b *eventBus) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if !strings.HasPrefix(e.Key, sub.prefix) {
+			continue
+		}
+
+		select {
+		case sub.events <- e:
+		default:
+			delete(b.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// publish sends an event of a lock key
+func (s *Server) publish(typ string, key string, generation int64, previous int64) {
+	s.events.publish(Event{
+		Type:       typ,
+		Key:        key,
+		Generation: generation,
+		Previous:   previous,
+		Time:       time.Now().UTC(),
+	})
+}
+
+// watchExpiry publishes an expire event once the hold with the given
+// generation number expires, unless it is refreshed, released or taken
+// over before. A reentered lock keeps its generation number and expiry,
+// so the hold is watched already
+func (s *Server) watchExpiry(key string, generation int64, expires int64) {
+	if expires == -1 {
+		return
+	}
+
+	s.events.watch(hold{key: key, generation: generation}, time.Until(time.Unix(expires, 0)), func() {
+		info, err := s.locker.Get(key)
+		if err != nil {
+			return
+		}
+
+		for _, holder := range info.Holders {
+			if holder.Generation == generation && holder.Expired() {
+				s.publish(EventExpire, key, generation, 0)
+			}
+		}
+	})
+}
+
+// refreshed publishes the refresh and watches the renewed hold for expiry
+func (s *Server) refreshed(key string, generation int64, previous int64) {
+	s.events.unwatch(hold{key: key, generation: previous})
+	s.publish(EventRefresh, key, generation, previous)
+
+	info, err := s.locker.Get(key)
+	if err != nil {
+		return
+	}
+
+	for _, h := range info.Holders {
+		if h.Generation == generation {
+			s.watchExpiry(key, generation, h.Expires)
+		}
+	}
+}
+
+// released wakes up the requests waiting for the released lock and publishes the release
+func (s *Server) released(key string, generation int64) {
+	s.events.unwatch(hold{key: key, generation: generation})
+	s.waiters.notify(key)
+	s.publish(EventRelease, key, generation, 0)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) (int, error) {
+	prefix, ok := s.lockerKeyPrefix(r.URL.Query().Get("prefix"))
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return http.StatusInternalServerError, errors.New("streaming is not supported")
+	}
+
+	sub := s.events.subscribe(prefix)
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.events:
+			if !ok {
+				return 0, errEventsDropped
+			}
+
+			// internal locks such as semaphore permits are not streamed
+			if locker.IsInternalKey(e.Key) {
+				continue
+			}
+
+			e.Key = s.apiKey(e.Key)
+			data, err := json.Marshal(e)
+			if err != nil {
+				return 0, err
+			}
+
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return 0, nil
+		}
+	}
+}
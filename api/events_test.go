@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvents subscribes to the event stream and returns a channel of the received events
+func readEvents(t *testing.T, ts *httptest.Server, prefix string) <-chan Event {
+	resp, err := http.Get(ts.URL + "/api/events?prefix=" + prefix)
+	if err != nil {
+		t.Fatalf("could not subscribe to events: %v", err)
+	}
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan Event, eventBufferSize)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var e Event
+			if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e) == nil {
+				events <- e
+			}
+		}
+	}()
+
+	return events
+}
+
+func expectEvent(t *testing.T, events <-chan Event, typ string, key string, timeout time.Duration) Event {
+	select {
+	case e := <-events:
+		if e.Type != typ || e.Key != key {
+			t.Errorf("expected %s event of %s, received %+v", typ, key, e)
+		}
+		return e
+	case <-time.After(timeout):
+		t.Fatalf("expected %s event of %s, received none", typ, key)
+	}
+	return Event{}
+}
+
+func doRequest(t *testing.T, ts *httptest.Server, method string, path string, body string) *http.Response {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	return resp
+}
+
+func TestEventsStreamLockLifecycle(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		ts := httptest.NewServer(server.router)
+		defer ts.Close()
+		defer ts.CloseClientConnections()
+
+		events := readEvents(t, ts, "db.")
+
+		resp := doRequest(t, ts, "POST", "/api/locks", `{"key":"cache.sessions","ttl":300}`)
+		resp.Body.Close()
+
+		resp = doRequest(t, ts, "POST", "/api/locks", `{"key":"db.users","ttl":300}`)
+		var lock LockResponse
+		json.NewDecoder(resp.Body).Decode(&lock)
+		resp.Body.Close()
+
+		acquired := expectEvent(t, events, EventAcquire, "db.users", time.Second)
+		if acquired.Generation != lock.Generation {
+			t.Errorf("expected generation %d, received %d", lock.Generation, acquired.Generation)
+		}
+
+		resp = doRequest(t, ts, "PUT", "/api/locks/db.users", fmt.Sprintf(`{"generation":%d}`, lock.Generation))
+		json.NewDecoder(resp.Body).Decode(&lock)
+		resp.Body.Close()
+
+		refreshed := expectEvent(t, events, EventRefresh, "db.users", time.Second)
+		if refreshed.Generation != lock.Generation || refreshed.Previous != acquired.Generation {
+			t.Errorf("unexpected refresh event %+v", refreshed)
+		}
+
+		resp = doRequest(t, ts, "DELETE", "/api/locks/db.users", fmt.Sprintf(`{"generation":%d}`, lock.Generation))
+		resp.Body.Close()
+
+		expectEvent(t, events, EventRelease, "db.users", time.Second)
+	})
+}
+
+func TestEventsStreamExpiryAndTakeover(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		ts := httptest.NewServer(server.router)
+		defer ts.Close()
+		defer ts.CloseClientConnections()
+
+		events := readEvents(t, ts, "")
+
+		resp := doRequest(t, ts, "POST", "/api/locks", `{"key":"test","ttl":1}`)
+		resp.Body.Close()
+
+		acquired := expectEvent(t, events, EventAcquire, "test", time.Second)
+		expectEvent(t, events, EventExpire, "test", 3*time.Second)
+
+		resp = doRequest(t, ts, "POST", "/api/locks", `{"key":"test","ttl":300}`)
+		resp.Body.Close()
+
+		takeover := expectEvent(t, events, EventTakeover, "test", time.Second)
+		if takeover.Previous != acquired.Generation {
+			t.Errorf("expected previous generation %d, received %d", acquired.Generation, takeover.Previous)
+		}
+	})
+}
+
+func TestEventsStopExpiryTimers(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		ts := httptest.NewServer(server.router)
+		defer ts.Close()
+
+		watching := func() int {
+			server.events.mu.Lock()
+			defer server.events.mu.Unlock()
+			return len(server.events.watching)
+		}
+
+		resp := doRequest(t, ts, "POST", "/api/locks", `{"key":"test","ttl":300}`)
+		var lock LockResponse
+		json.NewDecoder(resp.Body).Decode(&lock)
+		resp.Body.Close()
+
+		if n := watching(); n != 1 {
+			t.Errorf("expected 1 hold watched after acquiring, got %d", n)
+		}
+
+		resp = doRequest(t, ts, "PUT", "/api/locks/test", fmt.Sprintf(`{"generation":%d}`, lock.Generation))
+		json.NewDecoder(resp.Body).Decode(&lock)
+		resp.Body.Close()
+
+		if n := watching(); n != 1 {
+			t.Errorf("expected 1 hold watched after refreshing, got %d", n)
+		}
+
+		resp = doRequest(t, ts, "DELETE", "/api/locks/test", fmt.Sprintf(`{"generation":%d}`, lock.Generation))
+		resp.Body.Close()
+
+		if n := watching(); n != 0 {
+			t.Errorf("expected no holds watched after releasing, got %d", n)
+		}
+	})
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	bus := newEventBus()
+	sub := bus.subscribe("")
+
+	for i := 0; i <= eventBufferSize; i++ {
+		bus.publish(Event{Type: EventAcquire, Key: "test"})
+	}
+
+	n := 0
+	for range sub.events {
+		n++
+	}
+
+	if n != eventBufferSize {
+		t.Errorf("expected %d buffered events, received %d", eventBufferSize, n)
+	}
+
+	// unsubscribing a dropped subscriber is a no-op
+	bus.unsubscribe(sub)
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/api/pb"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcServer serves the gRPC Locker service with the server's locker
+type grpcServer struct {
+	pb.UnimplementedLockerServer
+	s *Server
+}
+
+func (s *Server) newGRPCServer() *grpc.Server {
+	gs := grpc.NewServer()
+	pb.RegisterLockerServer(gs, &grpcServer{s: s})
+	return gs
+}
+
+// ListenAndServeGRPC serves the gRPC API on the network address. Unlike the
+// HTTP API it does not redirect to the cluster leader, the requests which
+// only the leader can serve fail with codes.Unavailable on other nodes
+func (s *Server) ListenAndServeGRPC(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.newGRPCServer().Serve(l)
+}
+
+var errInvalidArgument = status.Error(codes.InvalidArgument, "invalid argument")
+
+func (g *grpcServer) Lock(ctx context.Context, req *pb.LockRequest) (*pb.LockResponse, error) {
+	key, ok := g.s.lockerKey(req.Key)
+	if !ok || req.Wait < 0 || len(req.Owner) > MaxOwnerLength {
+		return nil, errInvalidArgument
+	}
+
+	shared := req.Mode == pb.LockMode_SHARED
+	if shared && req.Owner != "" {
+		return nil, errInvalidArgument
+	}
+
+	if !g.s.supportsKey(key) {
+		return nil, grpcError(locker.ErrNotSupported)
+	}
+
+	lock, err := g.s.lockMethod(shared, req.Owner)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	ttl := time.Second * time.Duration(req.Ttl)
+	wait := time.Second * time.Duration(req.Wait)
+
+	gen, err := g.s.lock(ctx, key, ttl, wait, req.Owner, lock)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &pb.LockResponse{Generation: gen}, nil
+}
+
+func (g *grpcServer) Refresh(_ context.Context, req *pb.RefreshRequest) (*pb.LockResponse, error) {
+	key, ok := g.s.lockerKey(req.Key)
+	if req.Generation < 1 || !ok {
+		return nil, errInvalidArgument
+	}
+
+	gen, err := g.s.locker.Refresh(key, req.Generation)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	g.s.refreshed(key, gen, req.Generation)
+
+	return &pb.LockResponse{Generation: gen}, nil
+}
+
+func (g *grpcServer) Release(_ context.Context, req *pb.ReleaseRequest) (*pb.ReleaseResponse, error) {
+	key, ok := g.s.lockerKey(req.Key)
+	if req.Generation < 1 || !ok {
+		return nil, errInvalidArgument
+	}
+
+	err := g.s.locker.Release(key, req.Generation)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	g.s.released(key, req.Generation)
+
+	return &pb.ReleaseResponse{}, nil
+}
+
+func (g *grpcServer) Get(_ context.Context, req *pb.GetRequest) (*pb.LockInfo, error) {
+	key, ok := g.s.lockerKey(req.Key)
+	if !ok {
+		return nil, errInvalidArgument
+	}
+
+	info, err := g.s.locker.Get(key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return g.s.newPBLockInfo(info), nil
+}
+
+func (g *grpcServer) List(_ context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	prefix, ok := g.s.lockerKeyPrefix(req.Prefix)
+	if !ok {
+		return nil, errInvalidArgument
+	}
+
+	cursor, ok := g.s.lockerKeyPrefix(req.Cursor)
+	if !ok {
+		return nil, errInvalidArgument
+	}
+
+	limit := DefaultListLimit
+	if req.Limit != 0 {
+		if req.Limit < 1 || req.Limit > MaxListLimit {
+			return nil, errInvalidArgument
+		}
+		limit = int(req.Limit)
+	}
+
+	locks, next, err := g.s.listLocks(prefix, cursor, limit)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &pb.ListResponse{
+		Locks:  make([]*pb.LockInfo, 0, len(locks)),
+		Cursor: g.s.apiKey(next),
+	}
+
+	for _, info := range locks {
+		res.Locks = append(res.Locks, g.s.newPBLockInfo(info))
+	}
+
+	return res, nil
+}
+
+func (g *grpcServer) Watch(req *pb.WatchRequest, stream pb.Locker_WatchServer) error {
+	prefix, ok := g.s.lockerKeyPrefix(req.Prefix)
+	if !ok {
+		return errInvalidArgument
+	}
+
+	sub := g.s.events.subscribe(prefix)
+	defer g.s.events.unsubscribe(sub)
+
+	for {
+		select {
+		case e, ok := <-sub.events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, errEventsDropped.Error())
+			}
+
+			// internal locks such as semaphore permits are not streamed
+			if locker.IsInternalKey(e.Key) {
+				continue
+			}
+
+			if err := stream.Send(g.s.newPBEvent(e)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+var pbEventTypes = map[string]pb.Event_Type{
+	EventAcquire:  pb.Event_ACQUIRE,
+	EventRefresh:  pb.Event_REFRESH,
+	EventRelease:  pb.Event_RELEASE,
+	EventExpire:   pb.Event_EXPIRE,
+	EventTakeover: pb.Event_TAKEOVER,
+}
+
+func (s *Server) newPBEvent(e Event) *pb.Event {
+	return &pb.Event{
+		Type:       pbEventTypes[e.Type],
+		Key:        s.apiKey(e.Key),
+		Generation: e.Generation,
+		Previous:   e.Previous,
+		Time:       timestamppb.New(e.Time),
+	}
+}
+
+func (s *Server) newPBLockInfo(info *locker.LockInfo) *pb.LockInfo {
+	res := &pb.LockInfo{
+		Key:     s.apiKey(info.Key),
+		Mode:    pb.LockMode_EXCLUSIVE,
+		Holders: make([]*pb.Holder, 0, len(info.Holders)),
+	}
+
+	if info.Shared {
+		res.Mode = pb.LockMode_SHARED
+	}
+
+	for _, h := range info.Holders {
+		holder := &pb.Holder{
+			Generation: h.Generation,
+			Ttl:        h.TTL,
+			Immortal:   h.Expires == -1,
+			Expired:    h.Expired(),
+			Owner:      h.Owner,
+			Holds:      int32(h.Holds),
+		}
+
+		if !holder.Immortal {
+			holder.ExpiresAt = timestamppb.New(time.Unix(h.Expires, 0))
+		}
+
+		if h.Acquired != 0 {
+			holder.AcquiredAt = timestamppb.New(time.Unix(h.Acquired, 0))
+		}
+
+		res.Holders = append(res.Holders, holder)
+	}
+
+	return res
+}
+
+// grpcError is the gRPC counterpart of renderError
+func grpcError(err error) error {
+	var code codes.Code
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, locker.ErrLockTaken):
+		code = codes.Aborted
+	case errors.Is(err, locker.ErrLockNotExist):
+		code = codes.NotFound
+	case errors.Is(err, locker.ErrGenNumberMismatch):
+		code = codes.FailedPrecondition
+	case errors.Is(err, locker.ErrNotLeader):
+		code = codes.Unavailable
+	case errors.Is(err, locker.ErrNotSupported):
+		code = codes.Unimplemented
+	case errors.Is(err, errWaitQueueFull):
+		code = codes.ResourceExhausted
+	default:
+		code = codes.Internal
+	}
+
+	return status.Error(code, err.Error())
+}
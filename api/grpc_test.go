@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/api/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func execGRPCTest(t *testing.T, fn func(server *Server, client pb.LockerClient)) {
+	execServerTest(t, func(server *Server) {
+		l := bufconn.Listen(1024 * 1024)
+
+		gs := server.newGRPCServer()
+		go gs.Serve(l)
+		defer gs.Stop()
+
+		dialer := func(context.Context, string) (net.Conn, error) {
+			return l.Dial()
+		}
+
+		conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+		if err != nil {
+			t.Fatalf("could not dial the gRPC server: %v", err)
+		}
+		defer conn.Close()
+
+		fn(server, pb.NewLockerClient(conn))
+	})
+}
+
+func expectCode(t *testing.T, err error, code codes.Code) {
+	if status.Code(err) != code {
+		t.Errorf("expected code %s, received %v", code, err)
+	}
+}
+
+func TestGRPCLockLifecycle(t *testing.T) {
+	execGRPCTest(t, func(server *Server, client pb.LockerClient) {
+		ctx := context.Background()
+
+		lock, err := client.Lock(ctx, &pb.LockRequest{Key: "test", Ttl: 300})
+		if err != nil {
+			t.Fatalf("unexpected error while locking: %v", err)
+		}
+
+		_, err = client.Lock(ctx, &pb.LockRequest{Key: "test", Ttl: 300})
+		expectCode(t, err, codes.Aborted)
+
+		refreshed, err := client.Refresh(ctx, &pb.RefreshRequest{Key: "test", Generation: lock.Generation})
+		if err != nil {
+			t.Fatalf("unexpected error while refreshing: %v", err)
+		}
+
+		_, err = client.Refresh(ctx, &pb.RefreshRequest{Key: "test", Generation: lock.Generation})
+		expectCode(t, err, codes.FailedPrecondition)
+
+		info, err := client.Get(ctx, &pb.GetRequest{Key: "test"})
+		if err != nil {
+			t.Fatalf("unexpected error while getting lock: %v", err)
+		}
+
+		if len(info.Holders) != 1 || info.Holders[0].Generation != refreshed.Generation || info.Holders[0].ExpiresAt == nil {
+			t.Errorf("unexpected lock %v", info)
+		}
+
+		_, err = client.Release(ctx, &pb.ReleaseRequest{Key: "test", Generation: refreshed.Generation})
+		if err != nil {
+			t.Fatalf("unexpected error while releasing: %v", err)
+		}
+
+		_, err = client.Get(ctx, &pb.GetRequest{Key: "test"})
+		expectCode(t, err, codes.NotFound)
+	})
+}
+
+func TestGRPCLockWaitsUntilDeadline(t *testing.T) {
+	execGRPCTest(t, func(server *Server, client pb.LockerClient) {
+		_, err := server.locker.Lock("test", 300*time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error while locking: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		_, err = client.Lock(ctx, &pb.LockRequest{Key: "test", Ttl: 300, Wait: 10})
+		expectCode(t, err, codes.DeadlineExceeded)
+	})
+}
+
+func TestGRPCListPagesThroughLocks(t *testing.T) {
+	execGRPCTest(t, func(server *Server, client pb.LockerClient) {
+		ctx := context.Background()
+
+		for _, key := range []string{"a", "b", "c"} {
+			if _, err := client.Lock(ctx, &pb.LockRequest{Key: key, Ttl: 300}); err != nil {
+				t.Fatalf("unexpected error while locking: %v", err)
+			}
+		}
+
+		var keys []string
+		cursor := ""
+		for {
+			page, err := client.List(ctx, &pb.ListRequest{Limit: 2, Cursor: cursor})
+			if err != nil {
+				t.Fatalf("unexpected error while listing: %v", err)
+			}
+
+			for _, info := range page.Locks {
+				keys = append(keys, info.Key)
+			}
+
+			if page.Cursor == "" {
+				break
+			}
+			cursor = page.Cursor
+		}
+
+		if len(keys) != 3 || keys[0] != "a" || keys[2] != "c" {
+			t.Errorf("unexpected keys %v", keys)
+		}
+
+		_, err := client.List(ctx, &pb.ListRequest{Limit: MaxListLimit + 1})
+		expectCode(t, err, codes.InvalidArgument)
+	})
+}
+
+func TestGRPCWatchStreamsEvents(t *testing.T) {
+	execGRPCTest(t, func(server *Server, client pb.LockerClient) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream, err := client.Watch(ctx, &pb.WatchRequest{Prefix: "db."})
+		if err != nil {
+			t.Fatalf("unexpected error while watching: %v", err)
+		}
+
+		// wait for the subscription before changing locks
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			server.events.mu.Lock()
+			n := len(server.events.subs)
+			server.events.mu.Unlock()
+
+			if n > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("watch did not subscribe to events")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if _, err := client.Lock(ctx, &pb.LockRequest{Key: "cache.sessions", Ttl: 300}); err != nil {
+			t.Fatalf("unexpected error while locking: %v", err)
+		}
+
+		lock, err := client.Lock(ctx, &pb.LockRequest{Key: "db.users", Ttl: 300})
+		if err != nil {
+			t.Fatalf("unexpected error while locking: %v", err)
+		}
+
+		e, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("unexpected error while receiving event: %v", err)
+		}
+
+		if e.Type != pb.Event_ACQUIRE || e.Key != "db.users" || e.Generation != lock.Generation {
+			t.Errorf("unexpected event %v", e)
+		}
+	})
+}
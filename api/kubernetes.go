@@ -0,0 +1,355 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+// MaxKubernetesLeaseSpecLength limits the length of the lease spec annotating its lock
+const MaxKubernetesLeaseSpecLength = 4096
+
+const (
+	kubernetesLeaseAPIVersion = "coordination.k8s.io/v1"
+	kubernetesLeasePath       = "/apis/coordination.k8s.io/v1/namespaces/{namespace}/leases"
+)
+
+var (
+	kubernetesNamespacePattern = regexp.MustCompile(`^[a-z0-9](?:[-a-z0-9]{0,61}[a-z0-9])?$`)
+	kubernetesNamePattern      = regexp.MustCompile(`^[a-z0-9](?:[-a-z0-9]*[a-z0-9])?(?:\.[a-z0-9](?:[-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// KubernetesLease is a coordination.k8s.io/v1 Lease
+type KubernetesLease struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Metadata   KubernetesObjectMeta `json:"metadata"`
+	Spec       KubernetesLeaseSpec  `json:"spec"`
+}
+
+// KubernetesObjectMeta is the part of the object metadata the lease API keeps,
+// the generation number of the lease's lock is its resource version
+type KubernetesObjectMeta struct {
+	Name              string     `json:"name"`
+	Namespace         string     `json:"namespace,omitempty"`
+	ResourceVersion   string     `json:"resourceVersion,omitempty"`
+	CreationTimestamp *time.Time `json:"creationTimestamp,omitempty"`
+}
+
+// KubernetesLeaseSpec is the spec of a lease, the times are kept
+// as sent since the clients compare them on their own
+type KubernetesLeaseSpec struct {
+	HolderIdentity       *string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *string `json:"acquireTime,omitempty"`
+	RenewTime            *string `json:"renewTime,omitempty"`
+	LeaseTransitions     *int32  `json:"leaseTransitions,omitempty"`
+}
+
+// KubernetesStatus is the body of the API's failed responses
+type KubernetesStatus struct {
+	APIVersion string                   `json:"apiVersion"`
+	Kind       string                   `json:"kind"`
+	Status     string                   `json:"status"`
+	Message    string                   `json:"message"`
+	Reason     string                   `json:"reason,omitempty"`
+	Details    *KubernetesStatusDetails `json:"details,omitempty"`
+	Code       int                      `json:"code"`
+}
+
+type KubernetesStatusDetails struct {
+	Name  string `json:"name,omitempty"`
+	Group string `json:"group,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+}
+
+// kubernetesLeaseOwner annotates the lock of a lease with its spec
+type kubernetesLeaseOwner struct {
+	Spec    KubernetesLeaseSpec `json:"spec"`
+	Created time.Time           `json:"created"`
+}
+
+var kubernetesReasons = map[int]string{
+	http.StatusBadRequest:          "BadRequest",
+	http.StatusNotFound:            "NotFound",
+	http.StatusConflict:            "Conflict",
+	http.StatusUnprocessableEntity: "Invalid",
+	http.StatusTooManyRequests:     "TooManyRequests",
+	http.StatusInternalServerError: "InternalError",
+	http.StatusServiceUnavailable:  "ServiceUnavailable",
+}
+
+// kubernetesLeaseKey returns the internal key of the lock of a lease, namespaces
+// have no dots so the keys of different namespaces do not clash
+func kubernetesLeaseKey(namespace string, name string) string {
+	return locker.InternalKeyPrefix + "lease." + namespace + "." + name
+}
+
+func renderKubernetes(w http.ResponseWriter, status int, data interface{}) (int, error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// renderKubernetesError responds with a failure status of the lease,
+// the reason is derived from the status code unless given
+func renderKubernetesError(w http.ResponseWriter, status int, reason string, name string, message string) (int, error) {
+	if reason == "" {
+		reason = kubernetesReasons[status]
+	}
+
+	res := &KubernetesStatus{
+		APIVersion: "v1",
+		Kind:       "Status",
+		Status:     "Failure",
+		Message:    message,
+		Reason:     reason,
+		Code:       status,
+	}
+
+	if name != "" {
+		res.Details = &KubernetesStatusDetails{Name: name, Group: "coordination.k8s.io", Kind: "leases"}
+	}
+
+	return renderKubernetes(w, status, res)
+}
+
+// renderKubernetesFailure renders a Status not describing any lease
+func renderKubernetesFailure(w http.ResponseWriter, status int, message string) (int, error) {
+	return renderKubernetesError(w, status, "", "", message)
+}
+
+func renderKubernetesNotFound(w http.ResponseWriter, name string) (int, error) {
+	return renderKubernetesError(w, http.StatusNotFound, "", name, fmt.Sprintf("leases.coordination.k8s.io %q not found", name))
+}
+
+func renderKubernetesAlreadyExists(w http.ResponseWriter, name string) (int, error) {
+	msg := fmt.Sprintf("leases.coordination.k8s.io %q already exists", name)
+	return renderKubernetesError(w, http.StatusConflict, "AlreadyExists", name, msg)
+}
+
+func renderKubernetesConflict(w http.ResponseWriter, name string) (int, error) {
+	msg := fmt.Sprintf("Operation cannot be fulfilled on leases.coordination.k8s.io %q: the object has been modified; please apply your changes to the latest version and try again", name)
+	return renderKubernetesError(w, http.StatusConflict, "", name, msg)
+}
+
+// newKubernetesLease describes the lease held by the lock, false is
+// returned for the locks not taken through the lease API
+func newKubernetesLease(info *locker.LockInfo, namespace string, name string) (*KubernetesLease, bool) {
+	h := info.Holders[0]
+
+	var owner kubernetesLeaseOwner
+	if info.Shared || json.Unmarshal([]byte(h.Owner), &owner) != nil {
+		return nil, false
+	}
+
+	return &KubernetesLease{
+		APIVersion: kubernetesLeaseAPIVersion,
+		Kind:       "Lease",
+		Metadata: KubernetesObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			ResourceVersion:   strconv.FormatInt(h.Generation, 10),
+			CreationTimestamp: &owner.Created,
+		},
+		Spec: owner.Spec,
+	}, true
+}
+
+// kubernetesLease returns the lease and the holder of its lock, nil if there is none
+func (s *Server) kubernetesLease(namespace string, name string) (*KubernetesLease, *locker.Holder, error) {
+	info, _, err := s.lockState(kubernetesLeaseKey(namespace, name), 0)
+	if err != nil || info == nil {
+		return nil, nil, err
+	}
+
+	lease, ok := newKubernetesLease(info, namespace, name)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	return lease, &info.Holders[0], nil
+}
+
+// decodeKubernetesLease decodes the lease sent to the namespace and
+// validates its name, a failure response is written if it is not valid
+func decodeKubernetesLease(w http.ResponseWriter, r *http.Request, namespace string) (*KubernetesLease, bool) {
+	var body KubernetesLease
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		renderKubernetesError(w, http.StatusBadRequest, "", "", "invalid lease: "+err.Error())
+		return nil, false
+	}
+
+	name := body.Metadata.Name
+	switch {
+	case !kubernetesNamespacePattern.MatchString(namespace):
+		renderKubernetesError(w, http.StatusUnprocessableEntity, "", name, "invalid namespace")
+	case body.Metadata.Namespace != "" && body.Metadata.Namespace != namespace:
+		renderKubernetesError(w, http.StatusBadRequest, "", name, "the namespace of the provided object does not match the namespace sent on the request")
+	case name == "":
+		renderKubernetesError(w, http.StatusUnprocessableEntity, "", name, "metadata.name: Required value")
+	case len(name) > 253 || !kubernetesNamePattern.MatchString(name):
+		renderKubernetesError(w, http.StatusUnprocessableEntity, "", name, "metadata.name: Invalid value")
+	default:
+		return &body, true
+	}
+
+	return nil, false
+}
+
+// encodeKubernetesLeaseOwner returns the owner to keep the lease spec as
+// and reports whether it is not too long
+func encodeKubernetesLeaseOwner(spec KubernetesLeaseSpec, created time.Time) (string, bool, error) {
+	data, err := json.Marshal(&kubernetesLeaseOwner{Spec: spec, Created: created})
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(data), len(data) <= MaxKubernetesLeaseSpecLength, nil
+}
+
+func (s *Server) handleKubernetesLeaseGet(w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	if !kubernetesNamespacePattern.MatchString(vars["namespace"]) || !kubernetesNamePattern.MatchString(vars["name"]) {
+		return renderKubernetesNotFound(w, vars["name"])
+	}
+
+	lease, _, err := s.kubernetesLease(vars["namespace"], vars["name"])
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderKubernetesFailure)
+	}
+
+	if lease == nil {
+		return renderKubernetesNotFound(w, vars["name"])
+	}
+
+	return renderKubernetes(w, http.StatusOK, lease)
+}
+
+// handleKubernetesLeaseCreate creates the lease by taking an immortal lock,
+// the server never expires leases as clients expire them by their renew time
+func (s *Server) handleKubernetesLeaseCreate(w http.ResponseWriter, r *http.Request) (int, error) {
+	namespace := mux.Vars(r)["namespace"]
+
+	body, ok := decodeKubernetesLease(w, r, namespace)
+	if !ok {
+		return 0, nil
+	}
+
+	name := body.Metadata.Name
+	created := time.Now().UTC().Truncate(time.Second)
+
+	owner, ok, err := encodeKubernetesLeaseOwner(body.Spec, created)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !ok {
+		return renderKubernetesError(w, http.StatusUnprocessableEntity, "", name, "spec: Too long")
+	}
+
+	// the same spec creating the lease again does not reenter the lock
+	lock, err := s.annotatedLockMethod(owner)
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderKubernetesFailure)
+	}
+
+	gen, err := s.lock(r.Context(), kubernetesLeaseKey(namespace, name), -1*time.Second, 0, "", lock)
+	if errors.Is(err, locker.ErrLockTaken) {
+		return renderKubernetesAlreadyExists(w, name)
+	}
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderKubernetesFailure)
+	}
+
+	body.APIVersion = kubernetesLeaseAPIVersion
+	body.Kind = "Lease"
+	body.Metadata.Namespace = namespace
+	body.Metadata.ResourceVersion = strconv.FormatInt(gen, 10)
+	body.Metadata.CreationTimestamp = &created
+
+	return renderKubernetes(w, http.StatusCreated, body)
+}
+
+// handleKubernetesLeaseUpdate replaces the spec of the lease, the lock of the
+// lease is swapped over to the new spec as its owner in a single step, so the
+// resource version changes with every update. A resource version other than
+// the current one fails with a conflict, an empty one updates unconditionally
+func (s *Server) handleKubernetesLeaseUpdate(w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+
+	body, ok := decodeKubernetesLease(w, r, vars["namespace"])
+	if !ok {
+		return 0, nil
+	}
+
+	name := body.Metadata.Name
+	if name != vars["name"] {
+		msg := fmt.Sprintf("the name of the object (%s) does not match the name on the URL (%s)", name, vars["name"])
+		return renderKubernetesError(w, http.StatusBadRequest, "", name, msg)
+	}
+
+	lease, holder, err := s.kubernetesLease(vars["namespace"], name)
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderKubernetesFailure)
+	}
+
+	if lease == nil {
+		return renderKubernetesNotFound(w, name)
+	}
+
+	rv := body.Metadata.ResourceVersion
+	if rv != "" && rv != lease.Metadata.ResourceVersion {
+		return renderKubernetesConflict(w, name)
+	}
+
+	created := *lease.Metadata.CreationTimestamp
+
+	owner, ok, err := encodeKubernetesLeaseOwner(body.Spec, created)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if !ok {
+		return renderKubernetesError(w, http.StatusUnprocessableEntity, "", name, "spec: Too long")
+	}
+
+	l, ok := s.locker.(locker.SwappingLocker)
+	if !ok {
+		return s.renderLockerError(w, r, locker.ErrNotSupported, renderKubernetesFailure)
+	}
+
+	key := kubernetesLeaseKey(vars["namespace"], name)
+	ttl := -1 * time.Second
+
+	gen, err := l.Swap(key, holder.Generation, owner, ttl)
+	if errors.Is(err, locker.ErrLockNotExist) || errors.Is(err, locker.ErrGenNumberMismatch) {
+		// the lease was deleted or updated in the meantime
+		return renderKubernetesConflict(w, name)
+	}
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderKubernetesFailure)
+	}
+
+	s.released(key, holder.Generation)
+	s.acquired(key, gen, 0, locker.NewMetadata(ttl).Expires)
+
+	body.APIVersion = kubernetesLeaseAPIVersion
+	body.Kind = "Lease"
+	body.Metadata.Namespace = vars["namespace"]
+	body.Metadata.ResourceVersion = strconv.FormatInt(gen, 10)
+	body.Metadata.CreationTimestamp = &created
+
+	return renderKubernetes(w, http.StatusOK, body)
+}
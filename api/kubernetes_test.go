@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+func execKubernetesTest(t *testing.T, fn func(server *Server)) {
+	fn(NewServer(locker.NewMemLocker(), WithKubernetesLeases()))
+}
+
+func kubernetesLeaseBody(name string, holder string, rv string) string {
+	return fmt.Sprintf(`{"apiVersion":"coordination.k8s.io/v1","kind":"Lease","metadata":{"name":"%s","namespace":"default","resourceVersion":"%s"},"spec":{"holderIdentity":"%s","leaseDurationSeconds":15,"acquireTime":"2021-05-29T10:24:00.000000Z","renewTime":"2021-05-29T10:24:00.000000Z","leaseTransitions":0}}`, name, rv, holder)
+}
+
+func kubernetesRequest(server *Server, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/apis/coordination.k8s.io/v1/namespaces/default/leases"+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+func decodeKubernetesResponse(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+}
+
+func TestKubernetesLeaseLifecycle(t *testing.T) {
+	execKubernetesTest(t, func(server *Server) {
+		w := kubernetesRequest(server, "GET", "/controller", "")
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+
+		var status KubernetesStatus
+		decodeKubernetesResponse(t, w, &status)
+
+		if status.Kind != "Status" || status.Reason != "NotFound" || status.Code != http.StatusNotFound {
+			t.Errorf("unexpected status %+v", status)
+		}
+
+		w = kubernetesRequest(server, "POST", "", kubernetesLeaseBody("controller", "node-1", ""))
+		if w.Result().StatusCode != http.StatusCreated {
+			t.Fatalf("expected status code %d, received %d", http.StatusCreated, w.Result().StatusCode)
+		}
+
+		var created KubernetesLease
+		decodeKubernetesResponse(t, w, &created)
+
+		if created.Metadata.ResourceVersion == "" || *created.Spec.HolderIdentity != "node-1" {
+			t.Fatalf("unexpected lease %+v", created)
+		}
+
+		w = kubernetesRequest(server, "GET", "/controller", "")
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var lease KubernetesLease
+		decodeKubernetesResponse(t, w, &lease)
+
+		if lease.Metadata.ResourceVersion != created.Metadata.ResourceVersion || *lease.Spec.LeaseDurationSeconds != 15 {
+			t.Errorf("expected created lease, received %+v", lease)
+		}
+
+		w = kubernetesRequest(server, "PUT", "/controller", kubernetesLeaseBody("controller", "node-2", lease.Metadata.ResourceVersion))
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var updated KubernetesLease
+		decodeKubernetesResponse(t, w, &updated)
+
+		if updated.Metadata.ResourceVersion == lease.Metadata.ResourceVersion {
+			t.Errorf("expected resource version to change")
+		}
+
+		if !updated.Metadata.CreationTimestamp.Equal(*created.Metadata.CreationTimestamp) {
+			t.Errorf("expected creation timestamp to be kept, received %v", updated.Metadata.CreationTimestamp)
+		}
+
+		w = kubernetesRequest(server, "GET", "/controller", "")
+		decodeKubernetesResponse(t, w, &lease)
+
+		if *lease.Spec.HolderIdentity != "node-2" || lease.Metadata.ResourceVersion != updated.Metadata.ResourceVersion {
+			t.Errorf("expected updated lease, received %+v", lease)
+		}
+	})
+}
+
+func TestKubernetesLeaseCreateConflicts(t *testing.T) {
+	execKubernetesTest(t, func(server *Server) {
+		kubernetesRequest(server, "POST", "", kubernetesLeaseBody("controller", "node-1", ""))
+
+		w := kubernetesRequest(server, "POST", "", kubernetesLeaseBody("controller", "node-2", ""))
+		if w.Result().StatusCode != http.StatusConflict {
+			t.Fatalf("expected status code %d, received %d", http.StatusConflict, w.Result().StatusCode)
+		}
+
+		var status KubernetesStatus
+		decodeKubernetesResponse(t, w, &status)
+
+		if status.Reason != "AlreadyExists" {
+			t.Errorf("expected reason AlreadyExists, received %q", status.Reason)
+		}
+	})
+}
+
+func TestKubernetesLeaseUpdateConflicts(t *testing.T) {
+	execKubernetesTest(t, func(server *Server) {
+		w := kubernetesRequest(server, "POST", "", kubernetesLeaseBody("controller", "node-1", ""))
+
+		var created KubernetesLease
+		decodeKubernetesResponse(t, w, &created)
+
+		kubernetesRequest(server, "PUT", "/controller", kubernetesLeaseBody("controller", "node-1", created.Metadata.ResourceVersion))
+
+		// the lease was renewed since node-2 read it
+		w = kubernetesRequest(server, "PUT", "/controller", kubernetesLeaseBody("controller", "node-2", created.Metadata.ResourceVersion))
+		if w.Result().StatusCode != http.StatusConflict {
+			t.Fatalf("expected status code %d, received %d", http.StatusConflict, w.Result().StatusCode)
+		}
+
+		var status KubernetesStatus
+		decodeKubernetesResponse(t, w, &status)
+
+		if status.Reason != "Conflict" {
+			t.Errorf("expected reason Conflict, received %q", status.Reason)
+		}
+
+		w = kubernetesRequest(server, "PUT", "/other", kubernetesLeaseBody("other", "node-2", ""))
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+
+		w = kubernetesRequest(server, "PUT", "/controller", kubernetesLeaseBody("other", "node-2", ""))
+		if w.Result().StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status code %d, received %d", http.StatusBadRequest, w.Result().StatusCode)
+		}
+	})
+}
+
+// slowReleaseLocker widens the window between a release and the next lock
+type slowReleaseLocker struct {
+	*locker.MemLocker
+}
+
+func (l slowReleaseLocker) Release(key string, generation int64) error {
+	err := l.MemLocker.Release(key, generation)
+	time.Sleep(10 * time.Millisecond)
+	return err
+}
+
+func TestKubernetesLeaseUpdateIsAtomic(t *testing.T) {
+	func(server *Server) {
+		kubernetesRequest(server, "POST", "", kubernetesLeaseBody("controller", "node-1", ""))
+
+		for i := 0; i < 20; i++ {
+			var wg sync.WaitGroup
+			var update, create *httptest.ResponseRecorder
+
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				update = kubernetesRequest(server, "PUT", "/controller", kubernetesLeaseBody("controller", "node-1", ""))
+			}()
+			go func() {
+				defer wg.Done()
+				// lands while a release taking part in the update would be in progress
+				time.Sleep(time.Millisecond)
+				create = kubernetesRequest(server, "POST", "", kubernetesLeaseBody("controller", "node-2", ""))
+			}()
+			wg.Wait()
+
+			// the lease never disappears for the create to take it over
+			if update.Result().StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, received %d", http.StatusOK, update.Result().StatusCode)
+			}
+
+			if create.Result().StatusCode != http.StatusConflict {
+				t.Fatalf("expected status code %d, received %d", http.StatusConflict, create.Result().StatusCode)
+			}
+		}
+
+		w := kubernetesRequest(server, "GET", "/controller", "")
+
+		var lease KubernetesLease
+		decodeKubernetesResponse(t, w, &lease)
+
+		if *lease.Spec.HolderIdentity != "node-1" {
+			t.Errorf("expected lease held by node-1, received %q", *lease.Spec.HolderIdentity)
+		}
+	}(NewServer(slowReleaseLocker{locker.NewMemLocker()}, WithKubernetesLeases()))
+}
+
+func TestKubernetesConcurrentCreatesTakeLeaseOnce(t *testing.T) {
+	func(server *Server) {
+		var wg sync.WaitGroup
+		var created int32
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := kubernetesRequest(server, "POST", "", kubernetesLeaseBody("controller", "node-1", ""))
+				if w.Result().StatusCode == http.StatusCreated {
+					atomic.AddInt32(&created, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if created != 1 {
+			t.Errorf("expected lease to be created once, created %d times", created)
+		}
+	}(NewServer(slowLockLocker{locker.NewMemLocker()}, WithKubernetesLeases()))
+}
+
+func TestKubernetesLeaseRejectsInvalidName(t *testing.T) {
+	execKubernetesTest(t, func(server *Server) {
+		w := kubernetesRequest(server, "POST", "", kubernetesLeaseBody("Controller_1", "node-1", ""))
+		if w.Result().StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected status code %d, received %d", http.StatusUnprocessableEntity, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestKubernetesLeasesAreDisabledByDefault(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		w := kubernetesRequest(server, "GET", "/controller", "")
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+
+		if w.Header().Get("Content-Type") == "application/json" {
+			t.Errorf("expected lease API not to be served")
+		}
+	})
+}
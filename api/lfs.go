@@ -0,0 +1,407 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+// MaxLFSPathLength limits the length of the paths of files locked through the Git LFS API
+const MaxLFSPathLength = 4096
+
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+type LFSRef struct {
+	Name string `json:"name"`
+}
+
+type LFSOwner struct {
+	Name string `json:"name"`
+}
+
+type LFSLock struct {
+	ID       string    `json:"id"`
+	Path     string    `json:"path"`
+	LockedAt time.Time `json:"locked_at"`
+	Owner    *LFSOwner `json:"owner,omitempty"`
+}
+
+type LFSLockRequest struct {
+	Path string  `json:"path"`
+	Ref  *LFSRef `json:"ref,omitempty"`
+}
+
+type LFSLockResponse struct {
+	Lock    *LFSLock `json:"lock,omitempty"`
+	Message string   `json:"message,omitempty"`
+}
+
+type LFSLockListResponse struct {
+	Locks      []LFSLock `json:"locks"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type LFSVerifyRequest struct {
+	Cursor string  `json:"cursor"`
+	Limit  int     `json:"limit"`
+	Ref    *LFSRef `json:"ref,omitempty"`
+}
+
+type LFSVerifyResponse struct {
+	Ours       []LFSLock `json:"ours"`
+	Theirs     []LFSLock `json:"theirs"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type LFSUnlockRequest struct {
+	Force bool    `json:"force"`
+	Ref   *LFSRef `json:"ref,omitempty"`
+}
+
+type LFSErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// lfsLockOwner annotates the lock of a file with the file and its owner
+type lfsLockOwner struct {
+	Path  string `json:"path"`
+	Owner string `json:"owner"`
+	Ref   string `json:"ref,omitempty"`
+}
+
+var lfsLockIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// lfsLockID returns the ID of the lock of a file, file paths are not valid lock keys
+func lfsLockID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:])
+}
+
+// lfsKeyPrefix returns the prefix of the internal keys of a repository's file
+// locks, it ends with '@' so that it matches no other repository's locks
+func lfsKeyPrefix(repo string) string {
+	return locker.InternalKeyPrefix + "lfs." + repo + "@"
+}
+
+func lfsKey(repo string, id string) string {
+	return lfsKeyPrefix(repo) + id
+}
+
+// lfsUser returns the name of the user making the request, the server
+// does not check the password and is meant to be run behind a proxy which does
+func lfsUser(r *http.Request) (string, bool) {
+	user, _, ok := r.BasicAuth()
+	return user, ok && user != ""
+}
+
+func renderLFS(w http.ResponseWriter, status int, data interface{}) (int, error) {
+	w.Header().Set("Content-Type", lfsMediaType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func renderLFSError(w http.ResponseWriter, status int, message string) (int, error) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("LFS-Authenticate", `Basic realm="Git LFS"`)
+	}
+	return renderLFS(w, status, &LFSErrorResponse{Message: message})
+}
+
+// newLFSLock describes the lock of a file, false is returned
+// for the locks not taken through the Git LFS API
+func newLFSLock(info *locker.LockInfo, id string) (*LFSLock, bool) {
+	h := info.Holders[0]
+
+	var owner lfsLockOwner
+	if info.Shared || json.Unmarshal([]byte(h.Owner), &owner) != nil || owner.Path == "" {
+		return nil, false
+	}
+
+	return &LFSLock{
+		ID:       id,
+		Path:     owner.Path,
+		LockedAt: time.Unix(h.Acquired, 0).UTC(),
+		Owner:    &LFSOwner{Name: owner.Owner},
+	}, true
+}
+
+// lfsLock returns the lock with the ID in the repository, nil if there is none
+func (s *Server) lfsLock(repo string, id string) (*LFSLock, *locker.Holder, error) {
+	info, _, err := s.lockState(lfsKey(repo, id), 0)
+	if err != nil || info == nil {
+		return nil, nil, err
+	}
+
+	lock, ok := newLFSLock(info, id)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	return lock, &info.Holders[0], nil
+}
+
+// lfsLocks returns a page of at most limit file locks of the repository sorted
+// by ID after the cursor and the cursor of the next page, empty if there are
+// no more locks
+func (s *Server) lfsLocks(repo string, cursor string, limit int) ([]LFSLock, string, error) {
+	prefix := lfsKeyPrefix(repo)
+
+	after := ""
+	if cursor != "" {
+		after = lfsKey(repo, cursor)
+	}
+
+	// locks not taken through the Git LFS API are skipped before paging, so
+	// that pages are full and the cursor always is the ID of a listed lock
+	infos, next, err := s.listPage(prefix, after, limit, func(info *locker.LockInfo) bool {
+		id := strings.TrimPrefix(info.Key, prefix)
+		if !lfsLockIDPattern.MatchString(id) {
+			return false
+		}
+
+		_, ok := newLFSLock(info, id)
+		return ok
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	locks := make([]LFSLock, 0, len(infos))
+	for _, info := range infos {
+		lock, _ := newLFSLock(info, strings.TrimPrefix(info.Key, prefix))
+		locks = append(locks, *lock)
+	}
+
+	return locks, strings.TrimPrefix(next, prefix), nil
+}
+
+// parseLFSLimit parses the maximum number of locks to return, 0 stands for the default
+func parseLFSLimit(limit int) (int, bool) {
+	if limit == 0 {
+		return DefaultListLimit, true
+	}
+	return limit, limit > 0 && limit <= MaxListLimit
+}
+
+func (s *Server) handleLFSLockCreate(w http.ResponseWriter, r *http.Request) (int, error) {
+	user, ok := lfsUser(r)
+	if !ok {
+		return renderLFSError(w, http.StatusUnauthorized, "credentials needed")
+	}
+
+	var body LFSLockRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return renderLFSError(w, http.StatusBadRequest, "invalid request")
+	}
+
+	vars := mux.Vars(r)
+	if body.Path == "" || len(body.Path) > MaxLFSPathLength || len(user) > MaxOwnerLength {
+		return renderLFSError(w, http.StatusUnprocessableEntity, "invalid path")
+	}
+
+	owner := lfsLockOwner{
+		Path:  body.Path,
+		Owner: user,
+	}
+	if body.Ref != nil {
+		owner.Ref = body.Ref.Name
+	}
+
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	id := lfsLockID(body.Path)
+	key := lfsKey(vars["repo"], id)
+
+	// the same user locking the file again does not reenter the lock
+	lock, err := s.annotatedLockMethod(string(data))
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderLFSError)
+	}
+
+	_, err = s.lock(r.Context(), key, -1*time.Second, 0, "", lock)
+	if errors.Is(err, locker.ErrLockTaken) {
+		existing, _, err := s.lfsLock(vars["repo"], id)
+		if err != nil {
+			return s.renderLockerError(w, r, err, renderLFSError)
+		}
+		return renderLFS(w, http.StatusConflict, &LFSLockResponse{Lock: existing, Message: "already created lock"})
+	}
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderLFSError)
+	}
+
+	res := &LFSLockResponse{
+		Lock: &LFSLock{
+			ID:       id,
+			Path:     body.Path,
+			LockedAt: time.Now().UTC().Truncate(time.Second),
+			Owner:    &LFSOwner{Name: user},
+		},
+	}
+
+	return renderLFS(w, http.StatusCreated, res)
+}
+
+func (s *Server) handleLFSLockList(w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	id := query.Get("id")
+	if path := query.Get("path"); path != "" {
+		if id != "" && id != lfsLockID(path) {
+			return renderLFS(w, http.StatusOK, &LFSLockListResponse{Locks: []LFSLock{}})
+		}
+		id = lfsLockID(path)
+	}
+
+	res := &LFSLockListResponse{
+		Locks: []LFSLock{},
+	}
+
+	if id != "" {
+		if !lfsLockIDPattern.MatchString(id) {
+			return renderLFS(w, http.StatusOK, res)
+		}
+
+		lock, _, err := s.lfsLock(vars["repo"], id)
+		if err != nil {
+			return s.renderLockerError(w, r, err, renderLFSError)
+		}
+
+		if lock != nil {
+			res.Locks = append(res.Locks, *lock)
+		}
+
+		return renderLFS(w, http.StatusOK, res)
+	}
+
+	cursor := query.Get("cursor")
+	if cursor != "" && !lfsLockIDPattern.MatchString(cursor) {
+		return renderLFSError(w, http.StatusUnprocessableEntity, "invalid cursor")
+	}
+
+	var limit int
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return renderLFSError(w, http.StatusUnprocessableEntity, "invalid limit")
+		}
+		limit = n
+	}
+
+	limit, ok := parseLFSLimit(limit)
+	if !ok {
+		return renderLFSError(w, http.StatusUnprocessableEntity, "invalid limit")
+	}
+
+	locks, next, err := s.lfsLocks(vars["repo"], cursor, limit)
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderLFSError)
+	}
+
+	res.Locks = locks
+	res.NextCursor = next
+
+	return renderLFS(w, http.StatusOK, res)
+}
+
+func (s *Server) handleLFSLockVerify(w http.ResponseWriter, r *http.Request) (int, error) {
+	user, ok := lfsUser(r)
+	if !ok {
+		return renderLFSError(w, http.StatusUnauthorized, "credentials needed")
+	}
+
+	var body LFSVerifyRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return renderLFSError(w, http.StatusBadRequest, "invalid request")
+	}
+
+	if body.Cursor != "" && !lfsLockIDPattern.MatchString(body.Cursor) {
+		return renderLFSError(w, http.StatusUnprocessableEntity, "invalid cursor")
+	}
+
+	limit, ok := parseLFSLimit(body.Limit)
+	if !ok {
+		return renderLFSError(w, http.StatusUnprocessableEntity, "invalid limit")
+	}
+
+	vars := mux.Vars(r)
+	locks, next, err := s.lfsLocks(vars["repo"], body.Cursor, limit)
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderLFSError)
+	}
+
+	res := &LFSVerifyResponse{
+		Ours:       []LFSLock{},
+		Theirs:     []LFSLock{},
+		NextCursor: next,
+	}
+
+	for _, lock := range locks {
+		if lock.Owner.Name == user {
+			res.Ours = append(res.Ours, lock)
+		} else {
+			res.Theirs = append(res.Theirs, lock)
+		}
+	}
+
+	return renderLFS(w, http.StatusOK, res)
+}
+
+func (s *Server) handleLFSUnlock(w http.ResponseWriter, r *http.Request) (int, error) {
+	user, ok := lfsUser(r)
+	if !ok {
+		return renderLFSError(w, http.StatusUnauthorized, "credentials needed")
+	}
+
+	var body LFSUnlockRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return renderLFSError(w, http.StatusBadRequest, "invalid request")
+	}
+
+	vars := mux.Vars(r)
+	if !lfsLockIDPattern.MatchString(vars["id"]) {
+		return renderLFSError(w, http.StatusNotFound, "lock not found")
+	}
+
+	lock, holder, err := s.lfsLock(vars["repo"], vars["id"])
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderLFSError)
+	}
+
+	if lock == nil {
+		return renderLFSError(w, http.StatusNotFound, "lock not found")
+	}
+
+	if lock.Owner.Name != user && !body.Force {
+		return renderLFSError(w, http.StatusForbidden, "lock is owned by "+lock.Owner.Name)
+	}
+
+	key := lfsKey(vars["repo"], vars["id"])
+	err = s.releaseHolds(key, *holder)
+	if err != nil {
+		return s.renderLockerError(w, r, err, renderLFSError)
+	}
+
+	s.released(key, holder.Generation)
+
+	return renderLFS(w, http.StatusOK, &LFSLockResponse{Lock: lock})
+}
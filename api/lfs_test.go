@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+func execLFSTest(t *testing.T, fn func(server *Server)) {
+	fn(NewServer(locker.NewMemLocker(), WithGitLFS()))
+}
+
+func lfsRequest(server *Server, method string, path string, user string, body string) *httptest.ResponseRecorder {
+	return lfsRepoRequest(server, "repo", method, path, user, body)
+}
+
+func lfsRepoRequest(server *Server, repo string, method string, path string, user string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/lfs/"+repo+"/"+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	if user != "" {
+		req.SetBasicAuth(user, "secret")
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLFSCreatesLock(t *testing.T) {
+	execLFSTest(t, func(server *Server) {
+		w := lfsRequest(server, "POST", "locks", "alice", `{"path":"assets/logo.psd","ref":{"name":"refs/heads/main"}}`)
+		if w.Result().StatusCode != http.StatusCreated {
+			t.Fatalf("expected status code %d, received %d", http.StatusCreated, w.Result().StatusCode)
+		}
+
+		var res LFSLockResponse
+		err := json.NewDecoder(w.Body).Decode(&res)
+		if err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+
+		if res.Lock == nil || res.Lock.Path != "assets/logo.psd" || res.Lock.Owner.Name != "alice" || res.Lock.ID == "" {
+			t.Fatalf("unexpected lock %+v", res.Lock)
+		}
+
+		w = lfsRequest(server, "POST", "locks", "bob", `{"path":"assets/logo.psd"}`)
+		if w.Result().StatusCode != http.StatusConflict {
+			t.Fatalf("expected status code %d, received %d", http.StatusConflict, w.Result().StatusCode)
+		}
+
+		var conflict LFSLockResponse
+		json.NewDecoder(w.Body).Decode(&conflict)
+
+		if conflict.Lock == nil || conflict.Lock.ID != res.Lock.ID || conflict.Lock.Owner.Name != "alice" {
+			t.Errorf("expected existing lock, received %+v", conflict.Lock)
+		}
+
+		// the owner locking the file again does not reenter the lock
+		w = lfsRequest(server, "POST", "locks", "alice", `{"path":"assets/logo.psd"}`)
+		if w.Result().StatusCode != http.StatusConflict {
+			t.Errorf("expected status code %d, received %d", http.StatusConflict, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestLFSConcurrentCreatesTakeLockOnce(t *testing.T) {
+	func(server *Server) {
+		var wg sync.WaitGroup
+		var created int32
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := lfsRequest(server, "POST", "locks", "alice", `{"path":"assets/logo.psd"}`)
+				if w.Result().StatusCode == http.StatusCreated {
+					atomic.AddInt32(&created, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if created != 1 {
+			t.Errorf("expected lock to be created once, created %d times", created)
+		}
+	}(NewServer(slowLockLocker{locker.NewMemLocker()}, WithGitLFS()))
+}
+
+func TestLFSRequiresCredentials(t *testing.T) {
+	execLFSTest(t, func(server *Server) {
+		w := lfsRequest(server, "POST", "locks", "", `{"path":"assets/logo.psd"}`)
+		if w.Result().StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, received %d", http.StatusUnauthorized, w.Result().StatusCode)
+		}
+
+		if w.Header().Get("LFS-Authenticate") == "" {
+			t.Errorf("expected LFS-Authenticate header to be set")
+		}
+	})
+}
+
+func TestLFSListsLocks(t *testing.T) {
+	execLFSTest(t, func(server *Server) {
+		lfsRequest(server, "POST", "locks", "alice", `{"path":"a.psd"}`)
+		lfsRequest(server, "POST", "locks", "alice", `{"path":"b.psd"}`)
+		lfsRequest(server, "POST", "locks", "bob", `{"path":"c.psd"}`)
+
+		// locks of other repositories are not listed
+		server.locker.Lock(lfsKey("other", lfsLockID("d.psd")), -1)
+
+		w := lfsRequest(server, "GET", "locks?limit=2", "alice", "")
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var page LFSLockListResponse
+		json.NewDecoder(w.Body).Decode(&page)
+
+		if len(page.Locks) != 2 || page.NextCursor == "" {
+			t.Fatalf("expected a page of 2 locks, received %+v", page)
+		}
+
+		w = lfsRequest(server, "GET", "locks?limit=2&cursor="+page.NextCursor, "alice", "")
+
+		var rest LFSLockListResponse
+		json.NewDecoder(w.Body).Decode(&rest)
+
+		if len(rest.Locks) != 1 || rest.NextCursor != "" {
+			t.Fatalf("expected the last lock, received %+v", rest)
+		}
+
+		w = lfsRequest(server, "GET", "locks?path=c.psd", "alice", "")
+
+		var filtered LFSLockListResponse
+		json.NewDecoder(w.Body).Decode(&filtered)
+
+		if len(filtered.Locks) != 1 || filtered.Locks[0].Path != "c.psd" || filtered.Locks[0].Owner.Name != "bob" {
+			t.Errorf("expected lock of c.psd, received %+v", filtered.Locks)
+		}
+	})
+}
+
+func TestLFSPagesOnlyRepositoryLocks(t *testing.T) {
+	execLFSTest(t, func(server *Server) {
+		for i := 0; i < 5; i++ {
+			lfsRepoRequest(server, "a", "POST", "locks", "alice", fmt.Sprintf(`{"path":"a%d.psd"}`, i))
+			lfsRepoRequest(server, "a.b", "POST", "locks", "alice", fmt.Sprintf(`{"path":"b%d.psd"}`, i))
+		}
+
+		// locks under the prefix not taken through the Git LFS API are not listed either
+		server.locker.Lock(lfsKey("a", "other"), -1)
+		server.locker.(locker.SharedLocker).LockShared(lfsKey("a", lfsLockID("shared.psd")), -1)
+
+		var paths []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatalf("expected paging to end, received %v", paths)
+			}
+
+			w := lfsRepoRequest(server, "a", "GET", "locks?limit=2&cursor="+cursor, "alice", "")
+			if w.Result().StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+			}
+
+			var page LFSLockListResponse
+			json.NewDecoder(w.Body).Decode(&page)
+
+			if page.NextCursor != "" && len(page.Locks) != 2 {
+				t.Fatalf("expected a full page before the last one, received %+v", page)
+			}
+
+			for _, lock := range page.Locks {
+				paths = append(paths, lock.Path)
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+
+		sort.Strings(paths)
+		if strings.Join(paths, ",") != "a0.psd,a1.psd,a2.psd,a3.psd,a4.psd" {
+			t.Errorf("expected the locks of the repository only, received %v", paths)
+		}
+	})
+}
+
+func TestLFSVerifiesLocks(t *testing.T) {
+	execLFSTest(t, func(server *Server) {
+		lfsRequest(server, "POST", "locks", "alice", `{"path":"a.psd"}`)
+		lfsRequest(server, "POST", "locks", "bob", `{"path":"b.psd"}`)
+
+		w := lfsRequest(server, "POST", "locks/verify", "alice", `{}`)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var res LFSVerifyResponse
+		json.NewDecoder(w.Body).Decode(&res)
+
+		if len(res.Ours) != 1 || res.Ours[0].Path != "a.psd" {
+			t.Errorf("expected own lock of a.psd, received %+v", res.Ours)
+		}
+
+		if len(res.Theirs) != 1 || res.Theirs[0].Path != "b.psd" {
+			t.Errorf("expected lock of b.psd by others, received %+v", res.Theirs)
+		}
+	})
+}
+
+func TestLFSUnlocks(t *testing.T) {
+	execLFSTest(t, func(server *Server) {
+		w := lfsRequest(server, "POST", "locks", "alice", `{"path":"a.psd"}`)
+
+		var created LFSLockResponse
+		json.NewDecoder(w.Body).Decode(&created)
+
+		w = lfsRequest(server, "POST", "locks/"+created.Lock.ID+"/unlock", "bob", `{}`)
+		if w.Result().StatusCode != http.StatusForbidden {
+			t.Errorf("expected status code %d, received %d", http.StatusForbidden, w.Result().StatusCode)
+		}
+
+		w = lfsRequest(server, "POST", "locks/"+created.Lock.ID+"/unlock", "bob", `{"force":true}`)
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var res LFSLockResponse
+		json.NewDecoder(w.Body).Decode(&res)
+
+		if res.Lock == nil || res.Lock.ID != created.Lock.ID {
+			t.Errorf("expected unlocked lock, received %+v", res.Lock)
+		}
+
+		w = lfsRequest(server, "POST", "locks/"+created.Lock.ID+"/unlock", "alice", `{}`)
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestLFSIsDisabledByDefault(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		w := lfsRequest(server, "POST", "locks", "alice", `{"path":"a.psd"}`)
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+	})
+}
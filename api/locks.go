@@ -1,19 +1,43 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
-	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/laurynasgadl/lockronomicon/pkg/locker"
 )
 
+// waitPollInterval limits how long a waiting request sleeps before retrying,
+// as expiry or a release on another node does not notify waiters
+const waitPollInterval = time.Second
+
+const (
+	LockModeExclusive = "exclusive"
+	LockModeShared    = "shared"
+)
+
+// MaxOwnerLength limits the length of lock owner identities
+const MaxOwnerLength = 256
+
+const (
+	// DefaultListLimit is the number of locks listed when no limit is given
+	DefaultListLimit = 100
+
+	// MaxListLimit limits the number of locks listed at once
+	MaxListLimit = 1000
+)
+
 type LockCreateRequest struct {
-	Key string `json:"key"`
-	Ttl int64  `json:"ttl"`
+	Key   string `json:"key"`
+	Ttl   int64  `json:"ttl"`
+	Wait  int64  `json:"wait"`
+	Mode  string `json:"mode"`
+	Owner string `json:"owner"`
 }
 
 type LockRefreshRequest struct {
@@ -25,6 +49,38 @@ type LockResponse struct {
 	Generation int64 `json:"generation"`
 }
 
+type LockInfoResponse struct {
+	Key     string               `json:"key"`
+	Mode    string               `json:"mode"`
+	Holders []LockHolderResponse `json:"holders"`
+}
+
+// LockHolderResponse describes a lock holder, remaining is the number of
+// seconds until the hold expires or -1 if the hold is immortal
+type LockHolderResponse struct {
+	Generation int64      `json:"generation"`
+	Ttl        int64      `json:"ttl"`
+	Immortal   bool       `json:"immortal"`
+	Expired    bool       `json:"expired"`
+	Remaining  int64      `json:"remaining"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	AcquiredAt *time.Time `json:"acquired_at,omitempty"`
+	Owner      string     `json:"owner,omitempty"`
+	Holds      int        `json:"holds,omitempty"`
+}
+
+// LockListResponse is a page of locks, cursor is
+// omitted once there are no more locks to list
+type LockListResponse struct {
+	Locks  []LockInfoResponse `json:"locks"`
+	Cursor string             `json:"cursor,omitempty"`
+}
+
+type LockWaitersResponse struct {
+	Waiters int `json:"waiters"`
+	Limit   int `json:"limit"`
+}
+
 func (s *Server) handleLockCreate(w http.ResponseWriter, r *http.Request) (int, error) {
 	var body LockCreateRequest
 	err := json.NewDecoder(r.Body).Decode(&body)
@@ -36,32 +92,46 @@ func (s *Server) handleLockCreate(w http.ResponseWriter, r *http.Request) (int,
 		return http.StatusUnprocessableEntity, nil
 	}
 
-	matched, err := regexp.Match(`^[\w.-]+$`, []byte(body.Key))
-	if !matched || err != nil {
+	key, ok := s.lockerKey(body.Key)
+	if !ok {
 		return http.StatusUnprocessableEntity, nil
 	}
 
-	gen, err := s.locker.Lock(body.Key, time.Second*time.Duration(body.Ttl))
-	if err != nil {
-		// check if the lock is expired and try to override if so
-		if errors.Is(err, locker.ErrLockTaken) {
-			gn, exp, e := s.locker.Expired(body.Key)
-			if e != nil || !exp {
-				return renderError(err)
-			}
+	if body.Wait < 0 {
+		return http.StatusUnprocessableEntity, nil
+	}
 
-			e = s.locker.Release(body.Key, gn)
-			if e != nil {
-				return renderError(err)
-			}
+	if !s.supportsKey(key) {
+		return renderError(locker.ErrNotSupported)
+	}
 
-			gen, err = s.locker.Lock(body.Key, time.Second*time.Duration(body.Ttl))
-			if err != nil {
-				return renderError(err)
-			}
-		} else {
-			return renderError(err)
+	if len(body.Owner) > MaxOwnerLength {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	var shared bool
+	switch body.Mode {
+	case "", LockModeExclusive:
+	case LockModeShared:
+		if body.Owner != "" {
+			return http.StatusUnprocessableEntity, nil
 		}
+		shared = true
+	default:
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	lock, err := s.lockMethod(shared, body.Owner)
+	if err != nil {
+		return renderError(err)
+	}
+
+	ttl := time.Second * time.Duration(body.Ttl)
+	wait := time.Second * time.Duration(body.Wait)
+
+	gen, err := s.lock(r.Context(), key, ttl, wait, body.Owner, lock)
+	if err != nil {
+		return renderError(err)
 	}
 
 	res := &LockResponse{
@@ -78,16 +148,18 @@ func (s *Server) handleLockRefresh(w http.ResponseWriter, r *http.Request) (int,
 		return http.StatusBadRequest, err
 	}
 
-	if body.Generation < 1 {
+	key, ok := s.lockerKey(mux.Vars(r)["key"])
+	if body.Generation < 1 || !ok {
 		return http.StatusUnprocessableEntity, nil
 	}
 
-	vars := mux.Vars(r)
-	gen, err := s.locker.Refresh(vars["key"], body.Generation)
+	gen, err := s.locker.Refresh(key, body.Generation)
 	if err != nil {
 		return renderError(err)
 	}
 
+	s.refreshed(key, gen, body.Generation)
+
 	res := &LockResponse{
 		Generation: gen,
 	}
@@ -102,15 +174,370 @@ func (s *Server) handleLockRelease(w http.ResponseWriter, r *http.Request) (int,
 		return http.StatusBadRequest, err
 	}
 
-	if body.Generation < 1 {
+	key, ok := s.lockerKey(mux.Vars(r)["key"])
+	if body.Generation < 1 || !ok {
 		return http.StatusUnprocessableEntity, nil
 	}
 
-	vars := mux.Vars(r)
-	err = s.locker.Release(vars["key"], body.Generation)
+	err = s.locker.Release(key, body.Generation)
 	if err != nil {
 		return renderError(err)
 	}
 
+	s.released(key, body.Generation)
+
 	return http.StatusOK, nil
 }
+
+func (s *Server) handleLockGet(w http.ResponseWriter, r *http.Request) (int, error) {
+	key, ok := s.lockerKey(mux.Vars(r)["key"])
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	info, err := s.locker.Get(key)
+	if err != nil {
+		return renderError(err)
+	}
+
+	return renderJSON(w, r, s.newLockInfoResponse(info, time.Now()))
+}
+
+func (s *Server) handleLockList(w http.ResponseWriter, r *http.Request) (int, error) {
+	query := r.URL.Query()
+	prefix, ok := s.lockerKeyPrefix(query.Get("prefix"))
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	cursor, ok := s.lockerKeyPrefix(query.Get("cursor"))
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	limit := DefaultListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxListLimit {
+			return http.StatusUnprocessableEntity, nil
+		}
+		limit = n
+	}
+
+	locks, next, err := s.listLocks(prefix, cursor, limit)
+	if err != nil {
+		return renderError(err)
+	}
+
+	res := &LockListResponse{
+		Locks:  make([]LockInfoResponse, 0, len(locks)),
+		Cursor: s.apiKey(next),
+	}
+
+	now := time.Now()
+	for _, info := range locks {
+		res.Locks = append(res.Locks, *s.newLockInfoResponse(info, now))
+	}
+
+	return renderJSON(w, r, res)
+}
+
+// listLocks returns a page of at most limit locks sorted after the cursor and the
+// cursor of the next page, empty if there are no more locks to list. Semaphore
+// permits and other internal locks are not listed by the locker
+func (s *Server) listLocks(prefix string, cursor string, limit int) ([]*locker.LockInfo, string, error) {
+	// one more lock tells whether there is another page
+	locks, err := s.locker.List(prefix, cursor, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(locks) > limit {
+		return locks[:limit], locks[limit-1].Key, nil
+	}
+	return locks, "", nil
+}
+
+// listPage returns a page of at most limit of the locks accepted by keep with keys
+// starting with the prefix, sorted after the given key, and the key of the last lock
+// of the page if there are more locks to list, empty otherwise. Locks are filtered
+// before paging, so that a page is only shorter than limit if it is the last one
+func (s *Server) listPage(prefix string, after string, limit int, keep func(info *locker.LockInfo) bool) ([]*locker.LockInfo, string, error) {
+	page := make([]*locker.LockInfo, 0, limit)
+
+	for {
+		// one more lock tells whether there is another page
+		locks, err := s.locker.List(prefix, after, limit+1)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, info := range locks {
+			if !keep(info) {
+				continue
+			}
+
+			if len(page) == limit {
+				return page, page[limit-1].Key, nil
+			}
+			page = append(page, info)
+		}
+
+		if len(locks) <= limit {
+			return page, "", nil
+		}
+		after = locks[len(locks)-1].Key
+	}
+}
+
+func (s *Server) newLockInfoResponse(info *locker.LockInfo, now time.Time) *LockInfoResponse {
+	res := &LockInfoResponse{
+		Key:     s.apiKey(info.Key),
+		Mode:    LockModeExclusive,
+		Holders: make([]LockHolderResponse, 0, len(info.Holders)),
+	}
+
+	if info.Shared {
+		res.Mode = LockModeShared
+	}
+
+	for _, h := range info.Holders {
+		res.Holders = append(res.Holders, newLockHolderResponse(h, now))
+	}
+
+	return res
+}
+
+func newLockHolderResponse(h locker.Holder, now time.Time) LockHolderResponse {
+	res := LockHolderResponse{
+		Generation: h.Generation,
+		Ttl:        h.TTL,
+		Immortal:   h.Expires == -1,
+		Expired:    h.Expired(),
+		Remaining:  -1,
+		Owner:      h.Owner,
+		Holds:      h.Holds,
+	}
+
+	if !res.Immortal {
+		expires := time.Unix(h.Expires, 0).UTC()
+		res.ExpiresAt = &expires
+
+		res.Remaining = h.Expires - now.Unix()
+		if res.Remaining < 0 {
+			res.Remaining = 0
+		}
+	}
+
+	if h.Acquired != 0 {
+		acquired := time.Unix(h.Acquired, 0).UTC()
+		res.AcquiredAt = &acquired
+	}
+
+	return res
+}
+
+func (s *Server) handleLockWaiters(w http.ResponseWriter, r *http.Request) (int, error) {
+	key, ok := s.lockerKey(mux.Vars(r)["key"])
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	res := &LockWaitersResponse{
+		Waiters: s.waiters.queued(key),
+		Limit:   s.waiters.limit,
+	}
+
+	return renderJSON(w, r, res)
+}
+
+// supportsKey reports whether the locker can take the lock on the key,
+// hierarchical keys need a locker detecting conflicts between levels
+func (s *Server) supportsKey(key string) bool {
+	if !isHierarchical(key) {
+		return true
+	}
+
+	h, ok := s.locker.(locker.HierarchicalLocker)
+	return ok && h.Hierarchical()
+}
+
+// releaseHolds releases the lock as many times as its owner took it,
+// an expired lock is released at once
+func (s *Server) releaseHolds(key string, holder locker.Holder) error {
+	holds := holder.Holds
+	if holds < 1 {
+		holds = 1
+	}
+
+	for i := 0; i < holds; i++ {
+		err := s.locker.Release(key, holder.Generation)
+		if errors.Is(err, locker.ErrLockNotExist) && i > 0 {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lockFunc is the locker method taking the lock in the requested mode
+type lockFunc func(key string, ttl time.Duration) (int64, error)
+
+// lockMethod returns the locker method taking the lock in
+// the mode, on behalf of the owner if it is not empty
+func (s *Server) lockMethod(shared bool, owner string) (lockFunc, error) {
+	if shared {
+		l, ok := s.locker.(locker.SharedLocker)
+		if !ok {
+			return nil, locker.ErrNotSupported
+		}
+		return l.LockShared, nil
+	}
+
+	if owner != "" {
+		l, ok := s.locker.(locker.ReentrantLocker)
+		if !ok {
+			return nil, locker.ErrNotSupported
+		}
+		return func(key string, ttl time.Duration) (int64, error) {
+			return l.LockOwned(key, owner, ttl)
+		}, nil
+	}
+
+	return s.locker.Lock, nil
+}
+
+// annotatedLockMethod returns the locker method taking the exclusive lock
+// with the annotation kept as its owner, the lock is never taken again
+// with the same annotation
+func (s *Server) annotatedLockMethod(annotation string) (lockFunc, error) {
+	l, ok := s.locker.(locker.AnnotatedLocker)
+	if !ok {
+		return nil, locker.ErrNotSupported
+	}
+
+	return func(key string, ttl time.Duration) (int64, error) {
+		return l.LockAnnotated(key, annotation, ttl)
+	}, nil
+}
+
+// lock takes the lock, waiting for it up to the wait duration if it is taken
+func (s *Server) lock(ctx context.Context, key string, ttl time.Duration, wait time.Duration, owner string, lock lockFunc) (int64, error) {
+	if owner != "" {
+		// the owner of a lock takes it again without queueing
+		// up behind the requests waiting for it to release it
+		gen, err := s.acquire(key, ttl, lock)
+		if errors.Is(err, locker.ErrLockTaken) && wait > 0 {
+			return s.acquireWait(ctx, key, ttl, wait, lock)
+		}
+		return gen, err
+	}
+
+	if wait > 0 {
+		return s.acquireWait(ctx, key, ttl, wait, lock)
+	}
+
+	// do not jump the queue of waiting requests
+	if s.waiters.queued(key) > 0 {
+		return 0, locker.ErrLockTaken
+	}
+
+	return s.acquire(key, ttl, lock)
+}
+
+// acquire takes the lock, overriding it if it is taken but expired
+func (s *Server) acquire(key string, ttl time.Duration, lock lockFunc) (int64, error) {
+	expires := locker.NewMetadata(ttl).Expires
+
+	gen, previous, err := s.take(key, ttl, lock)
+	if err != nil {
+		return 0, err
+	}
+
+	s.acquired(key, gen, previous, expires)
+	return gen, nil
+}
+
+// take takes the lock the same way acquire does without publishing it and
+// returns the generation number of the expired holder it took the lock
+// over from, 0 if the lock was not held
+func (s *Server) take(key string, ttl time.Duration, lock lockFunc) (int64, int64, error) {
+	gen, err := lock(key, ttl)
+	if !errors.Is(err, locker.ErrLockTaken) {
+		return gen, 0, err
+	}
+
+	// check if the lock is expired and try to override if so
+	gn, exp, e := s.locker.Expired(key)
+	if e != nil || !exp {
+		return 0, 0, err
+	}
+
+	e = s.locker.Release(key, gn)
+	if e != nil {
+		return 0, 0, err
+	}
+
+	gen, err = lock(key, ttl)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return gen, gn, nil
+}
+
+// acquired publishes the lock taken by take and watches the new hold for expiry
+func (s *Server) acquired(key string, generation int64, previous int64, expires int64) {
+	if previous != 0 {
+		s.events.unwatch(hold{key: key, generation: previous})
+		s.publish(EventTakeover, key, generation, previous)
+	} else {
+		s.publish(EventAcquire, key, generation, 0)
+	}
+
+	s.watchExpiry(key, generation, expires)
+}
+
+// acquireWait queues up for the lock and, once at the front of the queue,
+// retries acquire whenever the lock is released until it succeeds or
+// the wait duration passes
+func (s *Server) acquireWait(ctx context.Context, key string, ttl time.Duration, wait time.Duration, lock lockFunc) (int64, error) {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	wt, err := s.waiters.enqueue(key)
+	if err != nil {
+		return 0, err
+	}
+	defer s.waiters.leave(key, wt)
+
+	select {
+	case <-wt.ready:
+	case <-deadline.C:
+		return 0, locker.ErrLockTaken
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	for {
+		// subscribe before trying so that a release in between is not missed
+		released := s.waiters.wait(key)
+
+		gen, err := s.acquire(key, ttl, lock)
+		if !errors.Is(err, locker.ErrLockTaken) {
+			return gen, err
+		}
+
+		select {
+		case <-released:
+		case <-time.After(waitPollInterval):
+		case <-deadline.C:
+			return 0, err
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strings"
 	"testing"
 	"time"
@@ -14,20 +13,27 @@ import (
 	"github.com/laurynasgadl/lockronomicon/pkg/locker"
 )
 
-const lockerRootDir = "/tmp/test/locker"
-
 func execServerTest(t *testing.T, fn func(server *Server)) {
-	l, err := locker.NewFsLocker(lockerRootDir)
-	if err != nil {
-		t.Errorf("unexpected error: %v", err)
-	}
-	defer os.RemoveAll(lockerRootDir)
-
-	s := NewServer(l)
+	s := NewServer(locker.NewMemLocker())
 
 	fn(s)
 }
 
+// slowLockLocker widens the window between checking a lock and taking it
+type slowLockLocker struct {
+	*locker.MemLocker
+}
+
+func (l slowLockLocker) LockOwned(key string, owner string, ttl time.Duration) (int64, error) {
+	time.Sleep(10 * time.Millisecond)
+	return l.MemLocker.LockOwned(key, owner, ttl)
+}
+
+func (l slowLockLocker) LockAnnotated(key string, annotation string, ttl time.Duration) (int64, error) {
+	time.Sleep(10 * time.Millisecond)
+	return l.MemLocker.LockAnnotated(key, annotation, ttl)
+}
+
 func TestCreatesLock(t *testing.T) {
 	execServerTest(t, func(server *Server) {
 		body := strings.NewReader(`{"key":"test","ttl":-12}`)
@@ -261,3 +267,678 @@ func TestReleaseFailsOnRegeneratedLock(t *testing.T) {
 		}
 	})
 }
+
+type followerLocker struct {
+	locker.Locker
+}
+
+func (followerLocker) Lock(string, time.Duration) (int64, error) {
+	return 0, locker.ErrNotLeader
+}
+
+func (followerLocker) LeaderAPIAddr() (string, bool) {
+	return "10.0.0.1:80", true
+}
+
+func TestRedirectsToClusterLeader(t *testing.T) {
+	server := NewServer(followerLocker{})
+
+	body := strings.NewReader(`{"key":"test","ttl":300}`)
+	req := httptest.NewRequest("POST", "/api/locks", body)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expected status code %d, received %d", http.StatusTemporaryRedirect, w.Result().StatusCode)
+	}
+
+	if loc := w.Result().Header.Get("Location"); loc != "http://10.0.0.1:80/api/locks" {
+		t.Errorf("expected redirect to leader, received %s", loc)
+	}
+}
+
+func TestWaitAcquiresReleasedLock(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		key := "test"
+		gn, err := server.locker.Lock(key, -1*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+
+			body := strings.NewReader(fmt.Sprintf(`{"generation":%d}`, gn))
+			req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/locks/%s", key), body)
+			server.router.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		start := time.Now()
+
+		body := strings.NewReader(`{"key":"test","ttl":300,"wait":10}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		if elapsed := time.Since(start); elapsed >= waitPollInterval {
+			t.Errorf("expected release to wake up the waiting request, waited %v", elapsed)
+		}
+	})
+}
+
+func TestWaitTimesOut(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		_, err := server.locker.Lock("test", -1*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		body := strings.NewReader(`{"key":"test","ttl":300,"wait":1}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+	})
+}
+
+func waitForWaiters(t *testing.T, server *Server, key string, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for server.waiters.queued(key) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d waiters, have %d", n, server.waiters.queued(key))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWaitingRequestsAcquireInArrivalOrder(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		key := "test"
+		gn, err := server.locker.Lock(key, -1*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		results := make(chan string, 2)
+		for _, name := range []string{"first", "second"} {
+			go func(name string) {
+				body := strings.NewReader(`{"key":"test","ttl":-1,"wait":10}`)
+				req := httptest.NewRequest("POST", "/api/locks", body)
+				w := httptest.NewRecorder()
+				server.router.ServeHTTP(w, req)
+
+				var resp LockResponse
+				json.NewDecoder(w.Body).Decode(&resp)
+
+				results <- fmt.Sprintf("%s %d", name, resp.Generation)
+			}(name)
+
+			waitForWaiters(t, server, key, server.waiters.queued(key)+1)
+		}
+
+		// requests that do not wait can not jump the queue
+		body := strings.NewReader(`{"key":"test","ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+
+		req = httptest.NewRequest("GET", fmt.Sprintf("/api/locks/%s/waiters", key), nil)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var waiters LockWaitersResponse
+		err = json.NewDecoder(w.Body).Decode(&waiters)
+		if err != nil {
+			t.Errorf("could not decode response: %v", err)
+		}
+
+		if waiters.Waiters != 2 || waiters.Limit != DefaultMaxWaiters {
+			t.Errorf("unexpected waiters response: %+v", waiters)
+		}
+
+		for i := 0; i < 2; i++ {
+			body := strings.NewReader(fmt.Sprintf(`{"generation":%d}`, gn))
+			req := httptest.NewRequest("DELETE", fmt.Sprintf("/api/locks/%s", key), body)
+			server.router.ServeHTTP(httptest.NewRecorder(), req)
+
+			var name string
+			_, err := fmt.Sscanf(<-results, "%s %d", &name, &gn)
+			if err != nil {
+				t.Fatalf("unexpected result: %v", err)
+			}
+
+			if expected := []string{"first", "second"}[i]; name != expected {
+				t.Errorf("expected %s waiter to acquire the lock, %s did", expected, name)
+			}
+		}
+	})
+}
+
+func TestWaitQueueIsBounded(t *testing.T) {
+	server := NewServer(locker.NewMemLocker(), WithMaxWaiters(1))
+
+	_, err := server.locker.Lock("test", -1*time.Second)
+	if err != nil {
+		t.Errorf("unexpected error while locking: %v", err)
+	}
+
+	go func() {
+		body := strings.NewReader(`{"key":"test","ttl":300,"wait":2}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		server.router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	waitForWaiters(t, server, "test", 1)
+
+	body := strings.NewReader(`{"key":"test","ttl":300,"wait":2}`)
+	req := httptest.NewRequest("POST", "/api/locks", body)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status code %d, received %d", http.StatusTooManyRequests, w.Result().StatusCode)
+	}
+}
+
+func TestSharedLocksBlockExclusiveLock(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		var generations []int64
+		for i := 0; i < 2; i++ {
+			body := strings.NewReader(`{"key":"test","ttl":300,"mode":"shared"}`)
+			req := httptest.NewRequest("POST", "/api/locks", body)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusOK {
+				t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+			}
+
+			var resp LockResponse
+			err := json.NewDecoder(w.Body).Decode(&resp)
+			if err != nil {
+				t.Errorf("could not decode response: %v", err)
+			}
+			generations = append(generations, resp.Generation)
+		}
+
+		body := strings.NewReader(`{"key":"test","ttl":300,"mode":"exclusive"}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+
+		for _, gn := range generations {
+			body := strings.NewReader(fmt.Sprintf(`{"generation":%d}`, gn))
+			req := httptest.NewRequest("DELETE", "/api/locks/test", body)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusOK {
+				t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+			}
+		}
+
+		body = strings.NewReader(`{"key":"test","ttl":300,"mode":"exclusive"}`)
+		req = httptest.NewRequest("POST", "/api/locks", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestSharedLockNotSupportedByLocker(t *testing.T) {
+	server := NewServer(struct{ locker.Locker }{locker.NewMemLocker()})
+
+	body := strings.NewReader(`{"key":"test","ttl":300,"mode":"shared"}`)
+	req := httptest.NewRequest("POST", "/api/locks", body)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusNotImplemented {
+		t.Errorf("expected status code %d, received %d", http.StatusNotImplemented, w.Result().StatusCode)
+	}
+}
+
+func TestHierarchicalLocksConflict(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.Lock("tenant1/db", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		body := strings.NewReader(`{"key":"tenant1","ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+
+		body = strings.NewReader(fmt.Sprintf(`{"generation":%d}`, gn))
+		req = httptest.NewRequest("DELETE", "/api/locks/tenant1/db", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		body = strings.NewReader(`{"key":"tenant1","ttl":300}`)
+		req = httptest.NewRequest("POST", "/api/locks", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestRejectsInvalidHierarchicalKey(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, key := range []string{"tenant1/", "/tenant1", "tenant1//db", "tenant1/../db", "tenant1/watch", "tenant1/waiters/db"} {
+			body := strings.NewReader(fmt.Sprintf(`{"key":"%s","ttl":300}`, key))
+			req := httptest.NewRequest("POST", "/api/locks", body)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("expected status code %d for %s, received %d", http.StatusUnprocessableEntity, key, w.Result().StatusCode)
+			}
+		}
+	})
+}
+
+func TestAcceptsReservedNamesAsFirstKeyLevel(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, key := range []string{"watch", "waiters/db"} {
+			body := strings.NewReader(fmt.Sprintf(`{"key":"%s","ttl":300}`, key))
+			req := httptest.NewRequest("POST", "/api/locks", body)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusOK {
+				t.Errorf("expected status code %d for %s, received %d", http.StatusOK, key, w.Result().StatusCode)
+			}
+
+			req = httptest.NewRequest("GET", "/api/locks/"+key, nil)
+			w = httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			var resp LockInfoResponse
+			err := json.NewDecoder(w.Body).Decode(&resp)
+			if err != nil || resp.Key != key {
+				t.Errorf("expected lock %s to be described, received %+v %v", key, resp, err)
+			}
+		}
+	})
+}
+
+func TestDotKeyDelimiterSplitsKeysByDots(t *testing.T) {
+	server := NewServer(locker.NewMemLocker(), WithDotKeyDelimiter())
+
+	body := strings.NewReader(`{"key":"tenant1.db","ttl":300}`)
+	req := httptest.NewRequest("POST", "/api/locks", body)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+	}
+
+	if _, err := server.locker.Get("tenant1/db"); err != nil {
+		t.Errorf("expected lock to be held on tenant1/db: %v", err)
+	}
+
+	body = strings.NewReader(`{"key":"tenant1","ttl":300}`)
+	req = httptest.NewRequest("POST", "/api/locks", body)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusLocked {
+		t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+	}
+
+	req = httptest.NewRequest("GET", "/api/locks?prefix=tenant1.", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var list LockListResponse
+	err := json.NewDecoder(w.Body).Decode(&list)
+	if err != nil || len(list.Locks) != 1 || list.Locks[0].Key != "tenant1.db" {
+		t.Errorf("expected tenant1.db to be listed, received %+v %v", list, err)
+	}
+
+	req = httptest.NewRequest("GET", "/api/locks/tenant1.db", nil)
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	var info LockInfoResponse
+	err = json.NewDecoder(w.Body).Decode(&info)
+	if err != nil || info.Key != "tenant1.db" {
+		t.Errorf("expected tenant1.db to be described, received %+v %v", info, err)
+	}
+
+	for key, status := range map[string]int{"tenant1/cache": http.StatusUnprocessableEntity, "tenant1..cache": http.StatusUnprocessableEntity, ".tenant2": http.StatusUnprocessableEntity, "jobs.watch": http.StatusOK} {
+		body := strings.NewReader(fmt.Sprintf(`{"key":"%s","ttl":300}`, key))
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != status {
+			t.Errorf("expected status code %d for %s, received %d", status, key, w.Result().StatusCode)
+		}
+	}
+}
+
+func TestHierarchicalLockNotSupportedByLocker(t *testing.T) {
+	server := NewServer(struct{ locker.Locker }{locker.NewMemLocker()})
+
+	body := strings.NewReader(`{"key":"tenant1/db","ttl":300}`)
+	req := httptest.NewRequest("POST", "/api/locks", body)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusNotImplemented {
+		t.Errorf("expected status code %d, received %d", http.StatusNotImplemented, w.Result().StatusCode)
+	}
+}
+
+func TestOwnerReentersLock(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		var generations []int64
+		for i := 0; i < 2; i++ {
+			body := strings.NewReader(`{"key":"test","ttl":300,"owner":"job-1"}`)
+			req := httptest.NewRequest("POST", "/api/locks", body)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusOK {
+				t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+			}
+
+			var resp LockResponse
+			err := json.NewDecoder(w.Body).Decode(&resp)
+			if err != nil {
+				t.Errorf("could not decode response: %v", err)
+			}
+			generations = append(generations, resp.Generation)
+		}
+
+		if generations[0] != generations[1] {
+			t.Errorf("expected the same generation, received %v", generations)
+		}
+
+		body := strings.NewReader(`{"key":"test","ttl":300,"owner":"job-2"}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestOwnerReentersLockWithWaiters(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		_, err := server.locker.(locker.ReentrantLocker).LockOwned("test", "job-1", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		go func() {
+			body := strings.NewReader(`{"key":"test","ttl":300,"wait":2}`)
+			req := httptest.NewRequest("POST", "/api/locks", body)
+			server.router.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		waitForWaiters(t, server, "test", 1)
+
+		body := strings.NewReader(`{"key":"test","ttl":300,"owner":"job-1"}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestOwnerRejectedForSharedLock(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		body := strings.NewReader(`{"key":"test","ttl":300,"mode":"shared","owner":"job-1"}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected status code %d, received %d", http.StatusUnprocessableEntity, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestGetDescribesLock(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.(locker.ReentrantLocker).LockOwned("tenant1/db", "job-1", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		req := httptest.NewRequest("GET", "/api/locks/tenant1/db", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var resp LockInfoResponse
+		err = json.NewDecoder(w.Body).Decode(&resp)
+		if err != nil {
+			t.Errorf("could not decode response: %v", err)
+		}
+
+		if resp.Key != "tenant1/db" || resp.Mode != LockModeExclusive || len(resp.Holders) != 1 {
+			t.Fatalf("unexpected lock description: %+v", resp)
+		}
+
+		h := resp.Holders[0]
+		if h.Generation != gn || h.Ttl != 300 || h.Immortal || h.Expired || h.Owner != "job-1" {
+			t.Errorf("unexpected holder: %+v", h)
+		}
+
+		if h.Remaining < 299 || h.ExpiresAt == nil || h.AcquiredAt == nil {
+			t.Errorf("unexpected holder expiry: %+v", h)
+		}
+	})
+}
+
+func TestGetFailsOnNonExistingLock(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		req := httptest.NewRequest("GET", "/api/locks/test", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestListPagesThroughLocks(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, key := range []string{"db.users", "db.orders", "cache.sessions", "@semaphore.db.0"} {
+			_, err := server.locker.Lock(key, 300*time.Second)
+			if err != nil {
+				t.Errorf("unexpected error while locking: %v", err)
+			}
+		}
+
+		var keys []string
+		cursor := ""
+		for page := 0; page < 3; page++ {
+			req := httptest.NewRequest("GET", "/api/locks?limit=2&cursor="+cursor, nil)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+			}
+
+			var resp LockListResponse
+			err := json.NewDecoder(w.Body).Decode(&resp)
+			if err != nil {
+				t.Errorf("could not decode response: %v", err)
+			}
+
+			for _, lock := range resp.Locks {
+				keys = append(keys, lock.Key)
+			}
+
+			cursor = resp.Cursor
+			if cursor == "" {
+				break
+			}
+		}
+
+		if strings.Join(keys, ",") != "cache.sessions,db.orders,db.users" {
+			t.Errorf("unexpected locks listed: %v", keys)
+		}
+	})
+}
+
+// listCountingLocker counts the calls listing the locks
+type listCountingLocker struct {
+	*locker.MemLocker
+	lists int
+}
+
+func (l *listCountingLocker) List(prefix string, after string, limit int) ([]*locker.LockInfo, error) {
+	l.lists++
+	return l.MemLocker.List(prefix, after, limit)
+}
+
+func TestListNeedsSingleLockerCallPerPage(t *testing.T) {
+	l := &listCountingLocker{MemLocker: locker.NewMemLocker()}
+	server := NewServer(l)
+
+	for i := 0; i < 10; i++ {
+		server.locker.Lock(fmt.Sprintf("@semaphore.x@10.%d", i), 300*time.Second)
+	}
+	server.locker.Lock("a", 300*time.Second)
+	server.locker.Lock("b", 300*time.Second)
+
+	req := httptest.NewRequest("GET", "/api/locks?limit=1", nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+	}
+
+	if l.lists != 1 {
+		t.Errorf("expected a single locker list call, received %d", l.lists)
+	}
+}
+
+func TestListPagesAcrossInternalLocks(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, key := range []string{"0a", "@semaphore.x.0", "@semaphore.x.1", "@semaphore.x.2", "b", "c"} {
+			_, err := server.locker.Lock(key, 300*time.Second)
+			if err != nil {
+				t.Errorf("unexpected error while locking: %v", err)
+			}
+		}
+
+		var pages []string
+		cursor := ""
+		for page := 0; page < 3; page++ {
+			req := httptest.NewRequest("GET", "/api/locks?limit=2&cursor="+cursor, nil)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusOK {
+				t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+			}
+
+			var resp LockListResponse
+			err := json.NewDecoder(w.Body).Decode(&resp)
+			if err != nil {
+				t.Errorf("could not decode response: %v", err)
+			}
+
+			var keys []string
+			for _, lock := range resp.Locks {
+				keys = append(keys, lock.Key)
+			}
+			pages = append(pages, strings.Join(keys, ","))
+
+			cursor = resp.Cursor
+			if cursor == "" {
+				break
+			}
+		}
+
+		if strings.Join(pages, "|") != "0a,b|c" {
+			t.Errorf("unexpected pages listed: %v", pages)
+		}
+	})
+}
+
+func TestListFiltersByPrefix(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, key := range []string{"db.users", "cache.sessions"} {
+			_, err := server.locker.Lock(key, 300*time.Second)
+			if err != nil {
+				t.Errorf("unexpected error while locking: %v", err)
+			}
+		}
+
+		req := httptest.NewRequest("GET", "/api/locks?prefix=db.", nil)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		var resp LockListResponse
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		if err != nil {
+			t.Errorf("could not decode response: %v", err)
+		}
+
+		if len(resp.Locks) != 1 || resp.Locks[0].Key != "db.users" || resp.Cursor != "" {
+			t.Errorf("unexpected locks listed: %+v", resp)
+		}
+	})
+}
+
+func TestListRejectsInvalidLimit(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, limit := range []string{"0", "1001", "x"} {
+			req := httptest.NewRequest("GET", "/api/locks?limit="+limit, nil)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("expected status code %d for limit %s, received %d", http.StatusUnprocessableEntity, limit, w.Result().StatusCode)
+			}
+		}
+	})
+}
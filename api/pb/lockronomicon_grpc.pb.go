@@ -0,0 +1,323 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// LockerClient is the client API for Locker service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LockerClient interface {
+	// Lock acquires a lock, taking it over if it has expired.
+	Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error)
+	// Refresh extends the lock's TTL by its original amount
+	// and returns its new generation number.
+	Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*LockResponse, error)
+	// Release releases an owned lock.
+	Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error)
+	// Get describes a lock and its holders.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*LockInfo, error)
+	// List pages through the held locks sorted by key.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Watch streams the events of the locks with keys starting with the prefix.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Locker_WatchClient, error)
+}
+
+type lockerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLockerClient(cc grpc.ClientConnInterface) LockerClient {
+	return &lockerClient{cc}
+}
+
+func (c *lockerClient) Lock(ctx context.Context, in *LockRequest, opts ...grpc.CallOption) (*LockResponse, error) {
+	out := new(LockResponse)
+	err := c.cc.Invoke(ctx, "/lockronomicon.v1.Locker/Lock", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*LockResponse, error) {
+	out := new(LockResponse)
+	err := c.cc.Invoke(ctx, "/lockronomicon.v1.Locker/Refresh", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) Release(ctx context.Context, in *ReleaseRequest, opts ...grpc.CallOption) (*ReleaseResponse, error) {
+	out := new(ReleaseResponse)
+	err := c.cc.Invoke(ctx, "/lockronomicon.v1.Locker/Release", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*LockInfo, error) {
+	out := new(LockInfo)
+	err := c.cc.Invoke(ctx, "/lockronomicon.v1.Locker/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/lockronomicon.v1.Locker/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lockerClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Locker_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Locker_ServiceDesc.Streams[0], "/lockronomicon.v1.Locker/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &lockerWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Locker_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type lockerWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *lockerWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LockerServer is the server API for Locker service.
+// All implementations must embed UnimplementedLockerServer
+// for forward compatibility
+type LockerServer interface {
+	// Lock acquires a lock, taking it over if it has expired.
+	Lock(context.Context, *LockRequest) (*LockResponse, error)
+	// Refresh extends the lock's TTL by its original amount
+	// and returns its new generation number.
+	Refresh(context.Context, *RefreshRequest) (*LockResponse, error)
+	// Release releases an owned lock.
+	Release(context.Context, *ReleaseRequest) (*ReleaseResponse, error)
+	// Get describes a lock and its holders.
+	Get(context.Context, *GetRequest) (*LockInfo, error)
+	// List pages through the held locks sorted by key.
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Watch streams the events of the locks with keys starting with the prefix.
+	Watch(*WatchRequest, Locker_WatchServer) error
+	mustEmbedUnimplementedLockerServer()
+}
+
+// UnimplementedLockerServer must be embedded to have forward compatible implementations.
+type UnimplementedLockerServer struct {
+}
+
+func (UnimplementedLockerServer) Lock(context.Context, *LockRequest) (*LockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lock not implemented")
+}
+func (UnimplementedLockerServer) Refresh(context.Context, *RefreshRequest) (*LockResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
+func (UnimplementedLockerServer) Release(context.Context, *ReleaseRequest) (*ReleaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Release not implemented")
+}
+func (UnimplementedLockerServer) Get(context.Context, *GetRequest) (*LockInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedLockerServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedLockerServer) Watch(*WatchRequest, Locker_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedLockerServer) mustEmbedUnimplementedLockerServer() {}
+
+// UnsafeLockerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LockerServer will
+// result in compilation errors.
+type UnsafeLockerServer interface {
+	mustEmbedUnimplementedLockerServer()
+}
+
+func RegisterLockerServer(s grpc.ServiceRegistrar, srv LockerServer) {
+	s.RegisterService(&Locker_ServiceDesc, srv)
+}
+
+func _Locker_Lock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).Lock(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lockronomicon.v1.Locker/Lock",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).Lock(ctx, req.(*LockRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lockronomicon.v1.Locker/Refresh",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).Refresh(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_Release_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).Release(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lockronomicon.v1.Locker/Release",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).Release(ctx, req.(*ReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lockronomicon.v1.Locker/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LockerServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lockronomicon.v1.Locker/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LockerServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Locker_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LockerServer).Watch(m, &lockerWatchServer{stream})
+}
+
+type Locker_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type lockerWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *lockerWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Locker_ServiceDesc is the grpc.ServiceDesc for Locker service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Locker_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lockronomicon.v1.Locker",
+	HandlerType: (*LockerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lock",
+			Handler:    _Locker_Lock_Handler,
+		},
+		{
+			MethodName: "Refresh",
+			Handler:    _Locker_Refresh_Handler,
+		},
+		{
+			MethodName: "Release",
+			Handler:    _Locker_Release_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Locker_Get_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Locker_List_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Locker_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "lockronomicon.proto",
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+const (
+	// maxRESPArgs limits the number of arguments of a single RESP command
+	maxRESPArgs = 16
+
+	// maxRESPBulkLength limits the length of a single RESP command argument
+	maxRESPBulkLength = 64 * 1024
+)
+
+var (
+	errRESPProtocol   = errors.New("Protocol error")
+	errRESPInvalidKey = errors.New("invalid key or value")
+)
+
+// ListenAndServeRESP serves a subset of the Redis protocol on the network
+// address, so that Redis lock clients can use the locker:
+//
+//	SET key value NX [PX milliseconds | EX seconds]
+//	SETNX key value
+//	GET key
+//	CAD key value
+//	PEXPIRE key milliseconds
+//
+// The value a lock is set with is kept as its owner. CAD releases the
+// lock if it is held with the value and PEXPIRE renews it by its TTL
+func (s *Server) ListenAndServeRESP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.serveRESP(l)
+}
+
+// serveRESP accepts connections until the listener is closed, backing off
+// on other accept errors (e.g. running out of file descriptors) the same
+// way net/http does
+func (s *Server) serveRESP(l net.Listener) error {
+	defer l.Close()
+
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+
+			log.Printf("resp: accept error: %v; retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		go s.serveRESPConn(conn)
+	}
+}
+
+func (s *Server) serveRESPConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		args, err := readRESPCommand(r)
+		if errors.Is(err, errRESPProtocol) {
+			writeRESPError(w, "ERR "+err.Error())
+			w.Flush()
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("resp: %v", err)
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := s.execRESPCommand(w, args)
+
+		// replies to pipelined commands are written at once
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// execRESPCommand writes the reply to the command
+// and reports whether the connection is to be closed
+func (s *Server) execRESPCommand(w *bufio.Writer, args []string) bool {
+	name := strings.ToUpper(args[0])
+
+	switch {
+	case name == "PING" && len(args) == 1:
+		writeRESPSimple(w, "PONG")
+	case name == "PING" && len(args) == 2:
+		writeRESPBulk(w, args[1])
+	case name == "QUIT":
+		writeRESPSimple(w, "OK")
+		return true
+	case name == "SET" && len(args) >= 3:
+		s.respSet(w, args[1], args[2], args[3:])
+	case name == "SETNX" && len(args) == 3:
+		s.respSetnx(w, args[1], args[2])
+	case name == "GET" && len(args) == 2:
+		s.respGet(w, args[1])
+	case name == "CAD" && len(args) == 3:
+		s.respCad(w, args[1], args[2])
+	case name == "PEXPIRE" && len(args) == 3:
+		s.respPexpire(w, args[1], args[2])
+	case name == "PING" || name == "SET" || name == "SETNX" || name == "GET" || name == "CAD" || name == "PEXPIRE":
+		writeRESPError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	default:
+		writeRESPError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+
+	return false
+}
+
+func (s *Server) respSet(w *bufio.Writer, key string, value string, opts []string) {
+	var nx bool
+	ttl := -1 * time.Second
+
+	for i := 0; i < len(opts); i++ {
+		switch opt := strings.ToUpper(opts[i]); {
+		case opt == "NX":
+			nx = true
+		case (opt == "PX" || opt == "EX") && i+1 < len(opts):
+			n, err := strconv.ParseInt(opts[i+1], 10, 64)
+			if err != nil || n < 1 {
+				writeRESPError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+
+			if opt == "EX" {
+				n *= 1000
+			}
+
+			// locks expire with second precision
+			ttl = time.Second * time.Duration((n+999)/1000)
+			i++
+		default:
+			writeRESPError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	if !nx {
+		writeRESPError(w, "ERR only SET with NX is supported")
+		return
+	}
+
+	set, err := s.respTakeLock(key, value, ttl)
+	if err != nil {
+		writeRESPLockerError(w, err)
+		return
+	}
+
+	if !set {
+		writeRESPNull(w)
+		return
+	}
+
+	writeRESPSimple(w, "OK")
+}
+
+func (s *Server) respSetnx(w *bufio.Writer, key string, value string) {
+	set, err := s.respTakeLock(key, value, -1*time.Second)
+	if err != nil {
+		writeRESPLockerError(w, err)
+		return
+	}
+
+	if !set {
+		writeRESPInt(w, 0)
+		return
+	}
+
+	writeRESPInt(w, 1)
+}
+
+// respTakeLock takes the lock annotated with the value and reports
+// whether it was taken, the same value taking the lock again does not
+// reenter it. The value can not be empty, as the locks taken without
+// an owner are not held by RESP clients
+func (s *Server) respTakeLock(key string, value string, ttl time.Duration) (bool, error) {
+	key, ok := s.lockerKey(key)
+	if !ok || value == "" || len(value) > MaxOwnerLength {
+		return false, errRESPInvalidKey
+	}
+
+	if !s.supportsKey(key) {
+		return false, locker.ErrNotSupported
+	}
+
+	lock, err := s.annotatedLockMethod(value)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.lock(context.Background(), key, ttl, 0, "", lock)
+	if errors.Is(err, locker.ErrLockTaken) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// respHolder returns the locker key of the lock and the holder of the exclusive
+// lock, nil if the lock is not held, is held in shared mode or was taken without
+// an owner, so that RESP clients can not release the locks taken through the
+// other APIs
+func (s *Server) respHolder(key string) (string, *locker.Holder, error) {
+	key, ok := s.lockerKey(key)
+	if !ok {
+		return "", nil, nil
+	}
+
+	info, _, err := s.lockState(key, 0)
+	if err != nil || info == nil || info.Shared || info.Holders[0].Owner == "" {
+		return "", nil, err
+	}
+
+	return key, &info.Holders[0], nil
+}
+
+func (s *Server) respGet(w *bufio.Writer, key string) {
+	_, h, err := s.respHolder(key)
+	if err != nil {
+		writeRESPLockerError(w, err)
+		return
+	}
+
+	if h == nil {
+		writeRESPNull(w)
+		return
+	}
+
+	writeRESPBulk(w, h.Owner)
+}
+
+func (s *Server) respCad(w *bufio.Writer, key string, value string) {
+	key, h, err := s.respHolder(key)
+	if err != nil {
+		writeRESPLockerError(w, err)
+		return
+	}
+
+	if h == nil || h.Owner != value {
+		writeRESPInt(w, 0)
+		return
+	}
+
+	err = s.releaseHolds(key, *h)
+	if errors.Is(err, locker.ErrLockNotExist) || errors.Is(err, locker.ErrGenNumberMismatch) {
+		writeRESPInt(w, 0)
+		return
+	}
+	if err != nil {
+		writeRESPLockerError(w, err)
+		return
+	}
+
+	s.released(key, h.Generation)
+
+	writeRESPInt(w, 1)
+}
+
+func (s *Server) respPexpire(w *bufio.Writer, key string, ms string) {
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || n < 1 {
+		writeRESPError(w, "ERR invalid expire time in 'pexpire' command")
+		return
+	}
+
+	key, h, err := s.respHolder(key)
+	if err != nil {
+		writeRESPLockerError(w, err)
+		return
+	}
+
+	if h == nil {
+		writeRESPInt(w, 0)
+		return
+	}
+
+	// a lock is renewed by its own TTL only
+	if (n+999)/1000 != h.TTL {
+		writeRESPError(w, fmt.Sprintf("ERR the lock can only be renewed by its TTL of %d seconds", h.TTL))
+		return
+	}
+
+	gen, err := s.locker.Refresh(key, h.Generation)
+	if errors.Is(err, locker.ErrLockNotExist) || errors.Is(err, locker.ErrGenNumberMismatch) {
+		writeRESPInt(w, 0)
+		return
+	}
+	if err != nil {
+		writeRESPLockerError(w, err)
+		return
+	}
+
+	s.refreshed(key, gen, h.Generation)
+
+	writeRESPInt(w, 1)
+}
+
+// readRESPCommand reads a command sent as an array of bulk strings or inline
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxRESPArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("%w: expected '$', got '%.1s'", errRESPProtocol, line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxRESPBulkLength {
+			return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		if string(buf[size:]) != "\r\n" {
+			return nil, fmt.Errorf("%w: invalid bulk string", errRESPProtocol)
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("%w: too big request", errRESPProtocol)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func writeRESPSimple(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "+%s\r\n", s)
+}
+
+func writeRESPError(w *bufio.Writer, msg string) {
+	fmt.Fprintf(w, "-%s\r\n", msg)
+}
+
+// writeRESPLockerError is the RESP counterpart of renderError
+func writeRESPLockerError(w *bufio.Writer, err error) {
+	writeRESPError(w, "ERR "+err.Error())
+}
+
+func writeRESPInt(w *bufio.Writer, n int64) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+func writeRESPBulk(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func writeRESPNull(w *bufio.Writer) {
+	w.WriteString("$-1\r\n")
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+func execRESPTest(t *testing.T, fn func(server *Server, client *redis.Client)) {
+	execServerTest(t, func(server *Server) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("could not listen: %v", err)
+		}
+
+		go server.serveRESP(l)
+		defer l.Close()
+
+		client := redis.NewClient(&redis.Options{Addr: l.Addr().String()})
+		defer client.Close()
+
+		fn(server, client)
+	})
+}
+
+func TestRESPLockLifecycle(t *testing.T) {
+	execRESPTest(t, func(server *Server, client *redis.Client) {
+		ctx := context.Background()
+
+		ok, err := client.SetNX(ctx, "test", "token-1", 3*time.Second).Result()
+		if err != nil || !ok {
+			t.Fatalf("expected lock to be set, received %v %v", ok, err)
+		}
+
+		ok, err = client.SetNX(ctx, "test", "token-2", 3*time.Second).Result()
+		if err != nil || ok {
+			t.Errorf("expected lock to be taken, received %v %v", ok, err)
+		}
+
+		value, err := client.Get(ctx, "test").Result()
+		if err != nil || value != "token-1" {
+			t.Errorf("expected value token-1, received %q %v", value, err)
+		}
+
+		before, err := server.locker.Get("test")
+		if err != nil {
+			t.Fatalf("unexpected error while getting lock: %v", err)
+		}
+
+		// expiry is kept in whole seconds
+		time.Sleep(time.Second)
+
+		renewed, err := client.PExpire(ctx, "test", 3*time.Second).Result()
+		if err != nil || !renewed {
+			t.Errorf("expected lock to be renewed, received %v %v", renewed, err)
+		}
+
+		after, err := server.locker.Get("test")
+		if err != nil || after.Holders[0].Expires <= before.Holders[0].Expires {
+			t.Errorf("expected lock to be refreshed, received %+v %v", after, err)
+		}
+
+		if after.Holders[0].Generation != before.Holders[0].Generation {
+			t.Errorf("expected the owner's lock to keep its generation number, received %+v", after)
+		}
+
+		if _, err := client.PExpire(ctx, "test", 10*time.Second).Result(); err == nil {
+			t.Errorf("expected renewing by a different TTL to fail")
+		}
+
+		deleted, err := client.Do(ctx, "CAD", "test", "token-2").Int()
+		if err != nil || deleted != 0 {
+			t.Errorf("expected lock to stay, received %d %v", deleted, err)
+		}
+
+		deleted, err = client.Do(ctx, "CAD", "test", "token-1").Int()
+		if err != nil || deleted != 1 {
+			t.Errorf("expected lock to be deleted, received %d %v", deleted, err)
+		}
+
+		if _, err := client.Get(ctx, "test").Result(); err != redis.Nil {
+			t.Errorf("expected lock to be released, received %v", err)
+		}
+
+		if _, err := server.locker.Get("test"); err == nil {
+			t.Errorf("expected lock to be released")
+		}
+	})
+}
+
+func TestRESPSetDoesNotReenter(t *testing.T) {
+	execRESPTest(t, func(server *Server, client *redis.Client) {
+		ctx := context.Background()
+
+		client.SetNX(ctx, "test", "token-1", 0)
+
+		ok, err := client.SetNX(ctx, "test", "token-1", 0).Result()
+		if err != nil || ok {
+			t.Errorf("expected lock to be taken, received %v %v", ok, err)
+		}
+	})
+}
+
+func TestRESPConcurrentSetTakesLockOnce(t *testing.T) {
+	func(server *Server) {
+		var wg sync.WaitGroup
+		var taken int32
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if ok, _ := server.respTakeLock("test", "token-1", -1*time.Second); ok {
+					atomic.AddInt32(&taken, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if taken != 1 {
+			t.Errorf("expected lock to be taken once, taken %d times", taken)
+		}
+	}(NewServer(slowLockLocker{locker.NewMemLocker()}))
+}
+
+func TestRESPIgnoresLocksWithoutOwner(t *testing.T) {
+	execRESPTest(t, func(server *Server, client *redis.Client) {
+		ctx := context.Background()
+
+		req := httptest.NewRequest("POST", "/api/locks", strings.NewReader(`{"key":"victim","ttl":300}`))
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		if _, err := client.Get(ctx, "victim").Result(); err != redis.Nil {
+			t.Errorf("expected lock without an owner to have no value, received %v", err)
+		}
+
+		deleted, err := client.Do(ctx, "CAD", "victim", "").Int()
+		if err != nil || deleted != 0 {
+			t.Errorf("expected lock to stay, received %d %v", deleted, err)
+		}
+
+		renewed, err := client.PExpire(ctx, "victim", 300*time.Second).Result()
+		if err != nil || renewed {
+			t.Errorf("expected lock not to be renewed, received %v %v", renewed, err)
+		}
+
+		if _, err := server.locker.Get("victim"); err != nil {
+			t.Errorf("expected lock to be held, received %v", err)
+		}
+
+		if err := client.SetNX(ctx, "other", "", 0).Err(); err == nil {
+			t.Errorf("expected setting an empty value to fail")
+		}
+	})
+}
+
+func TestRESPSetTakesOverExpiredLock(t *testing.T) {
+	execRESPTest(t, func(server *Server, client *redis.Client) {
+		ctx := context.Background()
+
+		client.SetNX(ctx, "test", "token-1", 100*time.Millisecond)
+
+		time.Sleep(1100 * time.Millisecond)
+
+		ok, err := client.SetNX(ctx, "test", "token-2", time.Second).Result()
+		if err != nil || !ok {
+			t.Errorf("expected expired lock to be taken over, received %v %v", ok, err)
+		}
+	})
+}
+
+func TestRESPRejectsUnsupportedCommands(t *testing.T) {
+	execRESPTest(t, func(server *Server, client *redis.Client) {
+		ctx := context.Background()
+
+		if err := client.Set(ctx, "test", "token-1", 0).Err(); err == nil {
+			t.Errorf("expected SET without NX to fail")
+		}
+
+		if err := client.Del(ctx, "test").Err(); err == nil {
+			t.Errorf("expected DEL to fail")
+		}
+
+		if err := client.Ping(ctx).Err(); err != nil {
+			t.Errorf("unexpected error while pinging: %v", err)
+		}
+	})
+}
+
+func TestRESPClosesConnectionOnProtocolError(t *testing.T) {
+	execRESPTest(t, func(server *Server, client *redis.Client) {
+		conn, err := net.Dial("tcp", client.Options().Addr)
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("*1\r\n+PING\r\n"))
+
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil || !strings.HasPrefix(reply, "-ERR Protocol error") {
+			t.Errorf("expected protocol error, received %q %v", reply, err)
+		}
+	})
+}
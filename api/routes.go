@@ -11,6 +11,41 @@ func routes(s *Server) {
 
 	api := s.router.PathPrefix("/api").Subrouter()
 	api.Handle("/locks", s.apiHandle(s.handleLockCreate)).Methods("POST")
-	api.Handle("/locks/{key:[\\w.-]+$}", s.apiHandle(s.handleLockRefresh)).Methods("PUT")
-	api.Handle("/locks/{key:[\\w.-]+$}", s.apiHandle(s.handleLockRelease)).Methods("DELETE")
+	api.Handle("/locks", s.apiHandle(s.handleLockList)).Methods("GET")
+	api.Handle("/locks/batch", s.apiHandle(s.handleLockBatchCreate)).Methods("POST")
+	api.Handle("/locks/batch/release", s.apiHandle(s.handleLockBatchRelease)).Methods("POST")
+	api.Handle("/locks/{key:[\\w.-]+(?:/[\\w.-]+)*$}", s.apiHandle(s.handleLockRefresh)).Methods("PUT")
+	api.Handle("/locks/{key:[\\w.-]+(?:/[\\w.-]+)*$}", s.apiHandle(s.handleLockRelease)).Methods("DELETE")
+	api.Handle("/locks/{key:[\\w.-]+(?:/[\\w.-]+)*}/waiters", s.apiHandle(s.handleLockWaiters)).Methods("GET")
+	api.Handle("/locks/{key:[\\w.-]+(?:/[\\w.-]+)*}/watch", s.apiHandle(s.handleLockWatch)).Methods("GET")
+	api.Handle("/locks/{key:[\\w.-]+(?:/[\\w.-]+)*$}", s.apiHandle(s.handleLockGet)).Methods("GET")
+
+	api.Handle("/terraform/{key:[\\w.-]+(?:/[\\w.-]+)*}", s.apiHandle(s.handleTerraformLock)).Methods("LOCK")
+	api.Handle("/terraform/{key:[\\w.-]+(?:/[\\w.-]+)*}", s.apiHandle(s.handleTerraformUnlock)).Methods("UNLOCK")
+
+	api.Handle("/events", s.apiHandle(s.handleEvents)).Methods("GET")
+
+	api.Handle("/elections/{name:[\\w.-]+}", s.apiHandle(s.handleElectionCampaign)).Methods("POST")
+	api.Handle("/elections/{name:[\\w.-]+}", s.apiHandle(s.handleElectionRefresh)).Methods("PUT")
+	api.Handle("/elections/{name:[\\w.-]+}", s.apiHandle(s.handleElectionResign)).Methods("DELETE")
+	api.Handle("/elections/{name:[\\w.-]+}", s.apiHandle(s.handleElectionLeader)).Methods("GET")
+	api.Handle("/elections/{name:[\\w.-]+}/observe", s.apiHandle(s.handleElectionObserve)).Methods("GET")
+
+	api.Handle("/semaphores", s.apiHandle(s.handleSemaphoreAcquire)).Methods("POST")
+	api.Handle("/semaphores/{key:[\\w.-]+$}", s.apiHandle(s.handleSemaphoreRefresh)).Methods("PUT")
+	api.Handle("/semaphores/{key:[\\w.-]+$}", s.apiHandle(s.handleSemaphoreRelease)).Methods("DELETE")
+
+	if s.gitLFS {
+		lfs := s.router.PathPrefix("/lfs/{repo:[\\w.-]+}").Subrouter()
+		lfs.Handle("/locks", s.apiHandle(s.handleLFSLockCreate)).Methods("POST")
+		lfs.Handle("/locks", s.apiHandle(s.handleLFSLockList)).Methods("GET")
+		lfs.Handle("/locks/verify", s.apiHandle(s.handleLFSLockVerify)).Methods("POST")
+		lfs.Handle("/locks/{id}/unlock", s.apiHandle(s.handleLFSUnlock)).Methods("POST")
+	}
+
+	if s.leases {
+		s.router.Handle(kubernetesLeasePath, s.apiHandle(s.handleKubernetesLeaseCreate)).Methods("POST")
+		s.router.Handle(kubernetesLeasePath+"/{name}", s.apiHandle(s.handleKubernetesLeaseGet)).Methods("GET")
+		s.router.Handle(kubernetesLeasePath+"/{name}", s.apiHandle(s.handleKubernetesLeaseUpdate)).Methods("PUT")
+	}
 }
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+// MaxSemaphorePermits limits the number of permits a semaphore can hand out
+const MaxSemaphorePermits = 1024
+
+type SemaphoreAcquireRequest struct {
+	Key     string `json:"key"`
+	Permits int    `json:"permits"`
+	Ttl     int64  `json:"ttl"`
+}
+
+type SemaphoreRefreshRequest struct {
+	Permits    int   `json:"permits"`
+	Permit     int   `json:"permit"`
+	Generation int64 `json:"generation"`
+}
+
+type SemaphoreResponse struct {
+	Permit     int   `json:"permit"`
+	Generation int64 `json:"generation"`
+}
+
+// semaphoreKeyPrefix returns the prefix of the internal lock keys backing the permits
+// of a semaphore, it ends with '@' so that it matches no other semaphore's permits
+func semaphoreKeyPrefix(key string) string {
+	return locker.InternalKeyPrefix + "semaphore." + key + "@"
+}
+
+// semaphorePermitKey returns the lock key backing a single permit of a semaphore
+// handing out the given number of permits, so that permits taken by acquires
+// asking for another number can be told apart
+func semaphorePermitKey(key string, permits int, permit int) string {
+	return fmt.Sprintf("%s%d.%d", semaphoreKeyPrefix(key), permits, permit)
+}
+
+// validSemaphorePermit reports whether the permit exists in a semaphore
+// handing out the given number of permits
+func validSemaphorePermit(permits int, permit int) bool {
+	return permits > 0 && permits <= MaxSemaphorePermits && permit >= 0 && permit < permits
+}
+
+// semaphoreConflicts reports whether a permit of the semaphore is held by an
+// acquire asking for another number of permits. Expired permits are released
+// on the way, so that they do not linger once the number of permits changes
+func (s *Server) semaphoreConflicts(key string, permits int) (bool, error) {
+	prefix := semaphoreKeyPrefix(key)
+	own := fmt.Sprintf("%s%d.", prefix, permits)
+
+	after := ""
+	for {
+		locks, err := s.locker.List(prefix, after, MaxSemaphorePermits)
+		if err != nil {
+			return false, err
+		}
+
+		for _, info := range locks {
+			if strings.HasPrefix(info.Key, own) {
+				continue
+			}
+
+			h := info.Holders[0]
+			if !h.Expired() {
+				return true, nil
+			}
+
+			if s.locker.Release(info.Key, h.Generation) == nil {
+				s.released(info.Key, h.Generation)
+			}
+		}
+
+		if len(locks) < MaxSemaphorePermits {
+			return false, nil
+		}
+		after = locks[len(locks)-1].Key
+	}
+}
+
+func (s *Server) handleSemaphoreAcquire(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body SemaphoreAcquireRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if body.Key == "" || body.Permits < 1 || body.Permits > MaxSemaphorePermits {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	if !validKey(body.Key) || isHierarchical(body.Key) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	ttl := time.Second * time.Duration(body.Ttl)
+
+	// every permit is a lock of its own, take the first free one
+	for permit := 0; permit < body.Permits; permit++ {
+		key := semaphorePermitKey(body.Key, body.Permits, permit)
+
+		gen, err := s.acquire(key, ttl, s.locker.Lock)
+		if errors.Is(err, locker.ErrLockTaken) {
+			continue
+		}
+		if err != nil {
+			return renderError(err)
+		}
+
+		// checked once the permit is taken, so that of two acquires asking
+		// for different numbers of permits at once neither gets a permit
+		conflict, err := s.semaphoreConflicts(body.Key, body.Permits)
+		if err != nil || conflict {
+			if s.locker.Release(key, gen) == nil {
+				s.released(key, gen)
+			}
+
+			if err != nil {
+				return renderError(err)
+			}
+			return http.StatusConflict, nil
+		}
+
+		res := &SemaphoreResponse{
+			Permit:     permit,
+			Generation: gen,
+		}
+
+		return renderJSON(w, r, res)
+	}
+
+	return renderError(locker.ErrLockTaken)
+}
+
+func (s *Server) handleSemaphoreRefresh(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body SemaphoreRefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if body.Generation < 1 || !validSemaphorePermit(body.Permits, body.Permit) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	vars := mux.Vars(r)
+	key := semaphorePermitKey(vars["key"], body.Permits, body.Permit)
+	gen, err := s.locker.Refresh(key, body.Generation)
+	if err != nil {
+		return renderError(err)
+	}
+
+	s.refreshed(key, gen, body.Generation)
+
+	res := &SemaphoreResponse{
+		Permit:     body.Permit,
+		Generation: gen,
+	}
+
+	return renderJSON(w, r, res)
+}
+
+func (s *Server) handleSemaphoreRelease(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body SemaphoreRefreshRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if body.Generation < 1 || !validSemaphorePermit(body.Permits, body.Permit) {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	vars := mux.Vars(r)
+	key := semaphorePermitKey(vars["key"], body.Permits, body.Permit)
+	err = s.locker.Release(key, body.Generation)
+	if err != nil {
+		return renderError(err)
+	}
+
+	s.released(key, body.Generation)
+
+	return http.StatusOK, nil
+}
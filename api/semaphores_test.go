@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+func acquireSemaphore(t *testing.T, server *Server, body string) (*SemaphoreResponse, int) {
+	req := httptest.NewRequest("POST", "/api/semaphores", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		return nil, w.Result().StatusCode
+	}
+
+	var resp SemaphoreResponse
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Errorf("could not decode response: %v", err)
+	}
+
+	return &resp, http.StatusOK
+}
+
+func TestSemaphoreHandsOutLimitedPermits(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		permits := map[int]bool{}
+		for i := 0; i < 3; i++ {
+			resp, status := acquireSemaphore(t, server, `{"key":"test","permits":3,"ttl":300}`)
+			if status != http.StatusOK {
+				t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+			}
+			permits[resp.Permit] = true
+		}
+
+		if len(permits) != 3 {
+			t.Errorf("expected 3 distinct permits, received %v", permits)
+		}
+
+		_, status := acquireSemaphore(t, server, `{"key":"test","permits":3,"ttl":300}`)
+		if status != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, status)
+		}
+
+		// semaphores do not share keys with locks
+		body := strings.NewReader(`{"key":"test","ttl":300}`)
+		req := httptest.NewRequest("POST", "/api/locks", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestSemaphoreNeedsPlainLocksOnly(t *testing.T) {
+	// hides the shared, hierarchical and reentrant locks of the memory locker
+	server := NewServer(struct{ locker.Locker }{locker.NewMemLocker()})
+
+	for i := 0; i < 2; i++ {
+		_, status := acquireSemaphore(t, server, `{"key":"test","permits":2,"ttl":300}`)
+		if status != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, status)
+		}
+	}
+}
+
+func TestSemaphoreReleaseFreesPermit(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		resp, status := acquireSemaphore(t, server, `{"key":"test","permits":1,"ttl":300}`)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		body := strings.NewReader(fmt.Sprintf(`{"permits":1,"permit":%d,"generation":%d}`, resp.Permit, resp.Generation))
+		req := httptest.NewRequest("PUT", "/api/semaphores/test", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		var refreshed SemaphoreResponse
+		err := json.NewDecoder(w.Body).Decode(&refreshed)
+		if err != nil {
+			t.Errorf("could not decode response: %v", err)
+		}
+
+		if refreshed.Generation == resp.Generation {
+			t.Errorf("old generation returned")
+		}
+
+		body = strings.NewReader(fmt.Sprintf(`{"permits":1,"permit":%d,"generation":%d}`, resp.Permit, resp.Generation))
+		req = httptest.NewRequest("DELETE", "/api/semaphores/test", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusPreconditionFailed {
+			t.Errorf("expected status code %d, received %d", http.StatusPreconditionFailed, w.Result().StatusCode)
+		}
+
+		body = strings.NewReader(fmt.Sprintf(`{"permits":1,"permit":%d,"generation":%d}`, refreshed.Permit, refreshed.Generation))
+		req = httptest.NewRequest("DELETE", "/api/semaphores/test", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		_, status = acquireSemaphore(t, server, `{"key":"test","permits":1,"ttl":300}`)
+		if status != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, status)
+		}
+	})
+}
+
+func TestSemaphoreRejectsInvalidPermits(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, body := range []string{
+			`{"key":"test","permits":0,"ttl":300}`,
+			fmt.Sprintf(`{"key":"test","permits":%d,"ttl":300}`, MaxSemaphorePermits+1),
+		} {
+			_, status := acquireSemaphore(t, server, body)
+			if status != http.StatusUnprocessableEntity {
+				t.Errorf("expected status code %d, received %d", http.StatusUnprocessableEntity, status)
+			}
+		}
+	})
+}
+
+func TestSemaphoreRejectsOtherPermits(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		_, status := acquireSemaphore(t, server, `{"key":"test","permits":1,"ttl":300}`)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		_, status = acquireSemaphore(t, server, `{"key":"test","permits":1,"ttl":300}`)
+		if status != http.StatusLocked {
+			t.Errorf("expected status code %d, received %d", http.StatusLocked, status)
+		}
+
+		// the number of permits can not be raised by asking for more
+		for i := 0; i < 3; i++ {
+			_, status = acquireSemaphore(t, server, `{"key":"test","permits":5,"ttl":300}`)
+			if status != http.StatusConflict {
+				t.Errorf("expected status code %d, received %d", http.StatusConflict, status)
+			}
+		}
+
+		_, status = acquireSemaphore(t, server, `{"key":"other","permits":5,"ttl":300}`)
+		if status != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, status)
+		}
+	})
+}
+
+func TestSemaphoreChangesPermitsOnceReleased(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		resp, status := acquireSemaphore(t, server, `{"key":"test","permits":1,"ttl":300}`)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		body := strings.NewReader(fmt.Sprintf(`{"permits":1,"permit":%d,"generation":%d}`, resp.Permit, resp.Generation))
+		req := httptest.NewRequest("DELETE", "/api/semaphores/test", body)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		// nothing is kept once every permit is released
+		locks, err := server.locker.List("", "", 10)
+		if err != nil || len(locks) != 0 {
+			t.Errorf("expected no locks to be left, received %v %v", locks, err)
+		}
+
+		resp, status = acquireSemaphore(t, server, `{"key":"test","permits":5,"ttl":300}`)
+		if status != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, status)
+		}
+
+		// the permit is refreshed and released with the number of permits it was acquired with
+		body = strings.NewReader(fmt.Sprintf(`{"permits":1,"permit":%d,"generation":%d}`, resp.Permit, resp.Generation))
+		req = httptest.NewRequest("PUT", "/api/semaphores/test", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+
+		body = strings.NewReader(fmt.Sprintf(`{"permits":5,"permit":%d,"generation":%d}`, resp.Permit, resp.Generation))
+		req = httptest.NewRequest("PUT", "/api/semaphores/test", body)
+		w = httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,15 +10,67 @@ import (
 	"github.com/laurynasgadl/lockronomicon/pkg/locker"
 )
 
+// leaderLocator is implemented by clustered lockers which accept
+// lock state changes on the leader node only
+type leaderLocator interface {
+	LeaderAPIAddr() (string, bool)
+}
+
 type Server struct {
-	router *mux.Router
-	locker locker.Locker
+	router  *mux.Router
+	locker  locker.Locker
+	waiters *waiters
+	events  *eventBus
+	gitLFS  bool
+	leases  bool
+
+	// keyDelimiter splits the levels of the lock keys sent to the API
+	keyDelimiter string
+}
+
+type Option func(s *Server)
+
+// WithMaxWaiters limits the number of requests waiting for a single lock key
+func WithMaxWaiters(n int) Option {
+	return func(s *Server) {
+		s.waiters.limit = n
+	}
+}
+
+// WithGitLFS serves the Git LFS file locking API of every repository under /lfs/{repo}
+func WithGitLFS() Option {
+	return func(s *Server) {
+		s.gitLFS = true
+	}
+}
+
+// WithKubernetesLeases serves the coordination.k8s.io/v1 Lease API
+// under /apis/coordination.k8s.io/v1
+func WithKubernetesLeases() Option {
+	return func(s *Server) {
+		s.leases = true
+	}
 }
 
-func NewServer(locker locker.Locker) *Server {
+// WithDotKeyDelimiter splits hierarchical lock keys by dots in place of slashes,
+// e.g. a lock on "tenant1" conflicts with a lock on "tenant1.db" and slashes are
+// not allowed in lock keys
+func WithDotKeyDelimiter() Option {
+	return func(s *Server) {
+		s.keyDelimiter = "."
+	}
+}
+
+func NewServer(l locker.Locker, opts ...Option) *Server {
 	s := &Server{
-		router: mux.NewRouter(),
-		locker: locker,
+		router:       mux.NewRouter(),
+		locker:       l,
+		waiters:      newWaiters(DefaultMaxWaiters),
+		events:       newEventBus(),
+		keyDelimiter: locker.KeyDelimiter,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	routes(s)
 	return s
@@ -31,6 +84,10 @@ func (s *Server) apiHandle(fn func(w http.ResponseWriter, r *http.Request) (int,
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		status, err := fn(w, r)
 
+		if errors.Is(err, locker.ErrNotLeader) && s.redirectToLeader(w, r) {
+			return
+		}
+
 		if status != 0 {
 			txt := http.StatusText(status)
 			http.Error(w, fmt.Sprintf("%d %s", status, txt), status)
@@ -41,3 +98,20 @@ func (s *Server) apiHandle(fn func(w http.ResponseWriter, r *http.Request) (int,
 		}
 	})
 }
+
+// redirectToLeader redirects the request to the API of the cluster leader,
+// 307 makes clients repeat the same method with the same body
+func (s *Server) redirectToLeader(w http.ResponseWriter, r *http.Request) bool {
+	l, ok := s.locker.(leaderLocator)
+	if !ok {
+		return false
+	}
+
+	addr, ok := l.LeaderAPIAddr()
+	if !ok {
+		return false
+	}
+
+	http.Redirect(w, r, "http://"+addr+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	return true
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+// MaxTerraformLockInfoLength limits the length of the lock info Terraform locks a state with
+const MaxTerraformLockInfoLength = 4096
+
+// TerraformLockInfo is the lock info sent by the Terraform http backend,
+// the state lock is taken on its behalf
+type TerraformLockInfo struct {
+	ID        string    `json:"ID"`
+	Operation string    `json:"Operation"`
+	Info      string    `json:"Info"`
+	Who       string    `json:"Who"`
+	Version   string    `json:"Version"`
+	Created   time.Time `json:"Created"`
+	Path      string    `json:"Path"`
+}
+
+// terraformHolder returns the lock info of the holder of the state lock and
+// reports whether Terraform took the lock, any other lock is described by
+// its generation number only
+func terraformHolder(info *locker.LockInfo) (*TerraformLockInfo, locker.Holder, bool) {
+	h := info.Holders[0]
+
+	var li TerraformLockInfo
+	if info.Shared || json.Unmarshal([]byte(h.Owner), &li) != nil || li.ID == "" {
+		return &TerraformLockInfo{ID: strconv.FormatInt(h.Generation, 10)}, h, false
+	}
+
+	return &li, h, true
+}
+
+// renderTerraformHolder responds with the lock info of the holder of the state lock
+func (s *Server) renderTerraformHolder(w http.ResponseWriter, key string, status int) (int, error) {
+	info, _, err := s.lockState(key, 0)
+	if err != nil {
+		return renderError(err)
+	}
+
+	// the lock was released in the meantime
+	if info == nil {
+		return status, nil
+	}
+
+	li, _, _ := terraformHolder(info)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(li); err != nil {
+		return 0, err
+	}
+
+	return 0, nil
+}
+
+func (s *Server) handleTerraformLock(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body TerraformLockInfo
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	key, ok := s.lockerKey(mux.Vars(r)["key"])
+	if body.ID == "" || !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	if !s.supportsKey(key) {
+		return renderError(locker.ErrNotSupported)
+	}
+
+	owner, err := json.Marshal(body)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if len(owner) > MaxTerraformLockInfoLength {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	lock, err := s.lockMethod(false, string(owner))
+	if err != nil {
+		return renderError(err)
+	}
+
+	// Terraform does not refresh its locks, a state stays locked until unlocked,
+	// retrying a lock request locks the state again with the same lock info
+	_, err = s.lock(r.Context(), key, -1*time.Second, 0, string(owner), lock)
+	if errors.Is(err, locker.ErrLockTaken) {
+		return s.renderTerraformHolder(w, key, http.StatusLocked)
+	}
+	if err != nil {
+		return renderError(err)
+	}
+
+	return http.StatusOK, nil
+}
+
+// handleTerraformUnlock unlocks the state locked with the lock info's ID,
+// an empty body as sent by terraform force-unlock unlocks any Terraform lock
+func (s *Server) handleTerraformUnlock(w http.ResponseWriter, r *http.Request) (int, error) {
+	var body TerraformLockInfo
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return http.StatusBadRequest, err
+	}
+
+	key, ok := s.lockerKey(mux.Vars(r)["key"])
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	info, _, err := s.lockState(key, 0)
+	if err != nil {
+		return renderError(err)
+	}
+
+	if info == nil {
+		return renderError(locker.ErrLockNotExist)
+	}
+
+	li, h, ok := terraformHolder(info)
+	if !ok || (body.ID != "" && body.ID != li.ID) {
+		return s.renderTerraformHolder(w, key, http.StatusConflict)
+	}
+
+	err = s.releaseHolds(key, h)
+	if err != nil {
+		return renderError(err)
+	}
+
+	s.released(key, h.Generation)
+
+	return http.StatusOK, nil
+}
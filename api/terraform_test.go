@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func terraformLockInfo(id string) string {
+	return fmt.Sprintf(`{"ID":"%s","Operation":"OperationTypeApply","Info":"","Who":"user@host","Version":"1.0.0","Created":"2021-05-29T10:24:00Z","Path":""}`, id)
+}
+
+func terraformRequest(server *Server, method string, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/terraform/"+key, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTerraformLocksState(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		w := terraformRequest(server, "LOCK", "infra/prod", terraformLockInfo("a1"))
+		if w.Result().StatusCode != http.StatusOK {
+			t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		w = terraformRequest(server, "LOCK", "infra/prod", terraformLockInfo("b2"))
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Fatalf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+
+		var holder TerraformLockInfo
+		err := json.NewDecoder(w.Body).Decode(&holder)
+		if err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+
+		if holder.ID != "a1" || holder.Who != "user@host" {
+			t.Errorf("unexpected lock holder %+v", holder)
+		}
+
+		info, err := server.locker.Get("infra/prod")
+		if err != nil {
+			t.Fatalf("unexpected error while getting lock: %v", err)
+		}
+
+		if info.Holders[0].Expires != -1 {
+			t.Errorf("expected state lock to be immortal")
+		}
+
+		// retrying the lock request succeeds
+		w = terraformRequest(server, "LOCK", "infra/prod", terraformLockInfo("a1"))
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		w = terraformRequest(server, "UNLOCK", "infra/prod", terraformLockInfo("b2"))
+		if w.Result().StatusCode != http.StatusConflict {
+			t.Errorf("expected status code %d, received %d", http.StatusConflict, w.Result().StatusCode)
+		}
+
+		w = terraformRequest(server, "UNLOCK", "infra/prod", terraformLockInfo("a1"))
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		if _, err := server.locker.Get("infra/prod"); err == nil {
+			t.Errorf("expected state lock to be released")
+		}
+	})
+}
+
+func TestTerraformForceUnlock(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		terraformRequest(server, "LOCK", "infra/prod", terraformLockInfo("a1"))
+
+		w := terraformRequest(server, "UNLOCK", "infra/prod", "")
+		if w.Result().StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+		}
+
+		w = terraformRequest(server, "UNLOCK", "infra/prod", "")
+		if w.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("expected status code %d, received %d", http.StatusNotFound, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestTerraformDoesNotUnlockOtherLocks(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.Lock("infra", 300*time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error while locking: %v", err)
+		}
+
+		w := terraformRequest(server, "LOCK", "infra", terraformLockInfo("a1"))
+		if w.Result().StatusCode != http.StatusLocked {
+			t.Fatalf("expected status code %d, received %d", http.StatusLocked, w.Result().StatusCode)
+		}
+
+		var holder TerraformLockInfo
+		json.NewDecoder(w.Body).Decode(&holder)
+
+		if holder.ID != fmt.Sprint(gn) {
+			t.Errorf("expected lock holder %d, received %+v", gn, holder)
+		}
+
+		w = terraformRequest(server, "UNLOCK", "infra", "")
+		if w.Result().StatusCode != http.StatusConflict {
+			t.Errorf("expected status code %d, received %d", http.StatusConflict, w.Result().StatusCode)
+		}
+	})
+}
+
+func TestTerraformRejectsLockWithoutID(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		w := terraformRequest(server, "LOCK", "infra", `{"Who":"user@host"}`)
+		if w.Result().StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("expected status code %d, received %d", http.StatusUnprocessableEntity, w.Result().StatusCode)
+		}
+	})
+}
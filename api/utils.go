@@ -4,10 +4,92 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"regexp"
+	"strings"
 
 	"github.com/laurynasgadl/lockronomicon/pkg/locker"
 )
 
+var keyPattern = regexp.MustCompile(`^[\w.-]+$`)
+
+// reservedKeyLevels can not be the levels of a key below the first, as lock
+// URLs ending with them are taken for the sub-resources of the key above
+var reservedKeyLevels = map[string]bool{
+	"waiters": true,
+	"watch":   true,
+}
+
+// validKey reports whether every level of a possibly hierarchical key is valid
+func validKey(key string) bool {
+	for i, part := range strings.Split(key, locker.KeyDelimiter) {
+		if !keyPattern.MatchString(part) || part == "." || part == ".." {
+			return false
+		}
+
+		if i > 0 && reservedKeyLevels[part] {
+			return false
+		}
+	}
+	return true
+}
+
+var keyPrefixPattern = regexp.MustCompile(`^[\w./-]*$`)
+
+// validKeyPrefix reports whether prefix, possibly empty, only has characters allowed in keys
+func validKeyPrefix(prefix string) bool {
+	return keyPrefixPattern.MatchString(prefix)
+}
+
+// lockerKey returns the locker key of a lock key sent to the API and whether
+// the key is valid. Levels split by the key delimiter of the server are split
+// by locker.KeyDelimiter in the locker
+func (s *Server) lockerKey(key string) (string, bool) {
+	if s.keyDelimiter == locker.KeyDelimiter {
+		return key, validKey(key)
+	}
+
+	// keys without slashes never end with the sub-resources of lock
+	// URLs, so there are no reserved levels
+	levels := strings.Split(key, s.keyDelimiter)
+	for _, level := range levels {
+		if !keyPattern.MatchString(level) {
+			return "", false
+		}
+	}
+	return strings.Join(levels, locker.KeyDelimiter), true
+}
+
+// lockerKeyPrefix is the lockerKey counterpart of key prefixes and list cursors
+func (s *Server) lockerKeyPrefix(prefix string) (string, bool) {
+	if !validKeyPrefix(prefix) {
+		return "", false
+	}
+
+	if s.keyDelimiter == locker.KeyDelimiter {
+		return prefix, true
+	}
+
+	if strings.Contains(prefix, locker.KeyDelimiter) {
+		return "", false
+	}
+	return strings.ReplaceAll(prefix, s.keyDelimiter, locker.KeyDelimiter), true
+}
+
+// apiKey returns the lock key the API describes a locker key with
+func (s *Server) apiKey(key string) string {
+	return strings.ReplaceAll(key, locker.KeyDelimiter, s.keyDelimiter)
+}
+
+// isHierarchical reports whether the key has more than one level
+func isHierarchical(key string) bool {
+	return strings.Contains(key, locker.KeyDelimiter)
+}
+
+// relatedKeys reports whether the keys are the same or one is nested under the other
+func relatedKeys(a string, b string) bool {
+	return a == b || strings.HasPrefix(a, b+locker.KeyDelimiter) || strings.HasPrefix(b, a+locker.KeyDelimiter)
+}
+
 func renderJSON(w http.ResponseWriter, _ *http.Request, data interface{}) (int, error) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(data); err != nil {
@@ -44,9 +126,30 @@ func renderError(err error) (int, error) {
 		status = http.StatusInternalServerError
 	case errors.Is(err, locker.ErrGenNumberMismatch):
 		status = http.StatusPreconditionFailed
+	case errors.Is(err, locker.ErrNotLeader):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, locker.ErrNotSupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, errWaitQueueFull):
+		status = http.StatusTooManyRequests
 	default:
 		status = http.StatusInternalServerError
 	}
 
 	return status, err
 }
+
+// renderLockerError renders the locker error with the render function
+// of an API having its own error bodies, requests reaching a cluster
+// follower are redirected to the leader
+func (s *Server) renderLockerError(w http.ResponseWriter, r *http.Request, err error, render func(w http.ResponseWriter, status int, message string) (int, error)) (int, error) {
+	if errors.Is(err, locker.ErrNotLeader) && s.redirectToLeader(w, r) {
+		return 0, nil
+	}
+
+	status, err := renderError(err)
+	if _, e := render(w, status, err.Error()); e != nil {
+		return 0, e
+	}
+	return 0, err
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"sync"
+)
+
+// DefaultMaxWaiters is the default limit of requests waiting for a single lock key
+const DefaultMaxWaiters = 64
+
+var errWaitQueueFull = errors.New("lock wait queue is full")
+
+// waiter is a request waiting for a lock, ready is closed
+// once it reaches the front of the key's queue
+type waiter struct {
+	ready chan struct{}
+}
+
+// waiters keeps a FIFO queue of requests waiting for each lock key,
+// only the request at the front of the queue may acquire the lock
+type waiters struct {
+	mu       sync.Mutex
+	limit    int
+	queues   map[string][]*waiter
+	released map[string]chan struct{}
+}
+
+func newWaiters(limit int) *waiters {
+	return &waiters{
+		limit:    limit,
+		queues:   make(map[string][]*waiter),
+		released: make(map[string]chan struct{}),
+	}
+}
+
+// enqueue adds a waiter to the back of the key's queue
+func (w *waiters) enqueue(key string) (*waiter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	queue := w.queues[key]
+	if len(queue) >= w.limit {
+		return nil, errWaitQueueFull
+	}
+
+	wt := &waiter{ready: make(chan struct{})}
+	if len(queue) == 0 {
+		close(wt.ready)
+	}
+
+	w.queues[key] = append(queue, wt)
+	return wt, nil
+}
+
+// leave removes the waiter from the key's queue and lets
+// the next one in if it was at the front
+func (w *waiters) leave(key string, wt *waiter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	queue := w.queues[key]
+	for i := range queue {
+		if queue[i] != wt {
+			continue
+		}
+
+		queue = append(queue[:i], queue[i+1:]...)
+		if i == 0 && len(queue) > 0 {
+			close(queue[0].ready)
+		}
+		break
+	}
+
+	if len(queue) == 0 {
+		delete(w.queues, key)
+	} else {
+		w.queues[key] = queue
+	}
+}
+
+// queued returns the number of requests waiting for the key
+func (w *waiters) queued(key string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.queues[key])
+}
+
+// wait returns a channel which is closed on the next notify of the key
+func (w *waiters) wait(key string) <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ch, ok := w.released[key]
+	if !ok {
+		ch = make(chan struct{})
+		w.released[key] = ch
+	}
+
+	return ch
+}
+
+// notify wakes up everyone waiting for the key or
+// for the keys above and below it in the hierarchy
+func (w *waiters) notify(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for k, ch := range w.released {
+		if relatedKeys(k, key) {
+			close(ch)
+			delete(w.released, k)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+const (
+	// DefaultWatchWait is the number of seconds a watch waits when no wait is given
+	DefaultWatchWait = 30
+
+	// MaxWatchWait limits the number of seconds a watch waits
+	MaxWatchWait = 300
+)
+
+// LockWatchResponse tells whether the lock changed from the watched
+// generation, lock is the current state, omitted if the lock is not held
+type LockWatchResponse struct {
+	Changed bool              `json:"changed"`
+	Lock    *LockInfoResponse `json:"lock,omitempty"`
+}
+
+// lockState returns the lock if it is held and reports whether none of its
+// live holders has the generation number, generation number 0 stands
+// for the lock not being held. A lock whose holders have all expired
+// is not held
+func (s *Server) lockState(key string, generation int64) (*locker.LockInfo, bool, error) {
+	info, err := s.locker.Get(key)
+	if errors.Is(err, locker.ErrLockNotExist) {
+		return nil, generation != 0, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	live := false
+	for _, h := range info.Holders {
+		if h.Expired() {
+			continue
+		}
+
+		if h.Generation == generation {
+			return info, false, nil
+		}
+		live = true
+	}
+
+	if !live {
+		return nil, generation != 0, nil
+	}
+
+	return info, true, nil
+}
+
+func (s *Server) handleLockWatch(w http.ResponseWriter, r *http.Request) (int, error) {
+	key, ok := s.lockerKey(mux.Vars(r)["key"])
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	generation, wait, ok := parseWatchQuery(r)
+	if !ok {
+		return http.StatusUnprocessableEntity, nil
+	}
+
+	info, changed, err := s.watchLock(r.Context(), key, generation, time.Second*time.Duration(wait))
+	if err != nil {
+		return renderError(err)
+	}
+
+	return renderJSON(w, r, s.newLockWatchResponse(info, changed))
+}
+
+// parseWatchQuery returns the generation number and the
+// number of seconds to wait given in the watch request's query
+func parseWatchQuery(r *http.Request) (int64, int, bool) {
+	query := r.URL.Query()
+
+	var generation int64
+	if v := query.Get("generation"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		generation = n
+	}
+
+	wait := DefaultWatchWait
+	if v := query.Get("wait"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > MaxWatchWait {
+			return 0, 0, false
+		}
+		wait = n
+	}
+
+	return generation, wait, true
+}
+
+// watchLock waits until no live holder of the lock has the generation number
+// or the wait duration passes and returns the lock's state as lockState does
+func (s *Server) watchLock(ctx context.Context, key string, generation int64, wait time.Duration) (*locker.LockInfo, bool, error) {
+	// subscribe before looking at the lock so that a change in between is not missed
+	sub := s.events.subscribe(key)
+	defer s.events.unsubscribe(sub)
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	events := sub.events
+	for {
+		info, changed, err := s.lockState(key, generation)
+		if err != nil || changed || wait == 0 {
+			return info, changed, err
+		}
+
+		// changes made on other nodes and expiry are only noticed by polling
+		select {
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		case <-time.After(waitPollInterval):
+		case <-deadline.C:
+			return info, false, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+func (s *Server) newLockWatchResponse(info *locker.LockInfo, changed bool) *LockWatchResponse {
+	res := &LockWatchResponse{
+		Changed: changed,
+	}
+
+	if info != nil {
+		res.Lock = s.newLockInfoResponse(info, time.Now())
+	}
+
+	return res
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func watchLock(t *testing.T, server *Server, url string) (*LockWatchResponse, time.Duration) {
+	start := time.Now()
+
+	req := httptest.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, received %d", http.StatusOK, w.Result().StatusCode)
+	}
+
+	var resp LockWatchResponse
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+
+	return &resp, time.Since(start)
+}
+
+func TestWatchReturnsOnRelease(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.Lock("test", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+
+			body := strings.NewReader(fmt.Sprintf(`{"generation":%d}`, gn))
+			req := httptest.NewRequest("DELETE", "/api/locks/test", body)
+			server.router.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		resp, elapsed := watchLock(t, server, fmt.Sprintf("/api/locks/test/watch?generation=%d&wait=10", gn))
+
+		if !resp.Changed || resp.Lock != nil {
+			t.Errorf("expected released lock, received %+v", resp)
+		}
+
+		if elapsed >= waitPollInterval {
+			t.Errorf("expected release to wake up the watch, waited %v", elapsed)
+		}
+	})
+}
+
+func TestWatchReturnsOnStaleGeneration(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.Lock("test", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		resp, _ := watchLock(t, server, fmt.Sprintf("/api/locks/test/watch?generation=%d", gn-1))
+
+		if !resp.Changed || resp.Lock == nil || resp.Lock.Holders[0].Generation != gn {
+			t.Errorf("expected lock with generation %d, received %+v", gn, resp)
+		}
+	})
+}
+
+func TestWatchReturnsOnAcquire(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+
+			body := strings.NewReader(`{"key":"test","ttl":300}`)
+			req := httptest.NewRequest("POST", "/api/locks", body)
+			server.router.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		resp, _ := watchLock(t, server, "/api/locks/test/watch?wait=10")
+
+		if !resp.Changed || resp.Lock == nil {
+			t.Errorf("expected acquired lock, received %+v", resp)
+		}
+	})
+}
+
+func TestWatchReturnsOnExpiry(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.Lock("test", time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		resp, _ := watchLock(t, server, fmt.Sprintf("/api/locks/test/watch?generation=%d&wait=10", gn))
+
+		if !resp.Changed || resp.Lock != nil {
+			t.Errorf("expected expired lock, received %+v", resp)
+		}
+	})
+}
+
+func TestWatchTimesOut(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		gn, err := server.locker.Lock("test", 300*time.Second)
+		if err != nil {
+			t.Errorf("unexpected error while locking: %v", err)
+		}
+
+		resp, _ := watchLock(t, server, fmt.Sprintf("/api/locks/test/watch?generation=%d&wait=1", gn))
+
+		if resp.Changed || resp.Lock == nil {
+			t.Errorf("expected unchanged lock, received %+v", resp)
+		}
+	})
+}
+
+func TestWatchRejectsInvalidParams(t *testing.T) {
+	execServerTest(t, func(server *Server) {
+		for _, url := range []string{
+			"/api/locks/test/watch?generation=-1",
+			"/api/locks/test/watch?generation=abc",
+			"/api/locks/test/watch?wait=-1",
+			fmt.Sprintf("/api/locks/test/watch?wait=%d", MaxWatchWait+1),
+		} {
+			req := httptest.NewRequest("GET", url, nil)
+			w := httptest.NewRecorder()
+			server.router.ServeHTTP(w, req)
+
+			if w.Result().StatusCode != http.StatusUnprocessableEntity {
+				t.Errorf("%s: expected status code %d, received %d", url, http.StatusUnprocessableEntity, w.Result().StatusCode)
+			}
+		}
+	})
+}
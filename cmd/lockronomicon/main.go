@@ -5,37 +5,130 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/laurynasgadl/lockronomicon/api"
 	"github.com/laurynasgadl/lockronomicon/build"
+	"github.com/laurynasgadl/lockronomicon/pkg/cluster"
 	"github.com/laurynasgadl/lockronomicon/pkg/locker"
 )
 
 var (
-	flagAddr string
-	flagPath string
-	flagVers bool
+	flagAddr    string
+	flagGRPC    string
+	flagRESP    string
+	flagBackend string
+	flagPath    string
+	flagDB      string
+	flagRedis   string
+	flagPgDSN   string
+	flagEtcd    string
+	flagRaftID  string
+	flagRaftDir string
+	flagPeers   string
+	flagBoot    bool
+	flagWaiters int
+	flagLFS     bool
+	flagLeases  bool
+	flagDotKeys bool
+	flagVers    bool
 )
 
 func init() {
 	flag.StringVar(&flagAddr, "address", ":80", "Network address to listen on")
+	flag.StringVar(&flagGRPC, "grpc-address", "", "Network address to serve the gRPC API on, disabled if empty")
+	flag.StringVar(&flagRESP, "resp-address", "", "Network address to serve the Redis protocol on, disabled if empty")
+	flag.StringVar(&flagBackend, "backend", "fs", "Locker backend (fs, memory, bolt, sqlite, redis, postgres, etcd, raft)")
 	flag.StringVar(&flagPath, "path", "/opt/locker", "FS locker workdir path")
+	flag.StringVar(&flagDB, "db", "/var/lib/lockronomicon.db", "Database file path for file-based database backends")
+	flag.StringVar(&flagRedis, "redis-addr", "localhost:6379", "Redis server address for redis backend")
+	flag.StringVar(&flagPgDSN, "postgres-dsn", "postgres://localhost/lockronomicon", "PostgreSQL connection string for postgres backend")
+	flag.StringVar(&flagEtcd, "etcd-endpoints", "localhost:2379", "Comma separated etcd endpoints for etcd backend")
+	flag.StringVar(&flagRaftID, "raft-id", "", "This node's ID for raft backend, must be one of the peer IDs")
+	flag.StringVar(&flagRaftDir, "raft-dir", "/var/lib/lockronomicon", "Raft log and snapshot path for raft backend")
+	flag.StringVar(&flagPeers, "raft-peers", "", "Comma separated id=raftAddr=apiAddr cluster members for raft backend")
+	flag.BoolVar(&flagBoot, "raft-bootstrap", false, "Bootstrap the raft cluster with the configured peers")
+	flag.IntVar(&flagWaiters, "max-waiters", api.DefaultMaxWaiters, "Maximum number of requests waiting for a single lock key")
+	flag.BoolVar(&flagLFS, "git-lfs", false, "Serve the Git LFS file locking API under /lfs/{repo}")
+	flag.BoolVar(&flagLeases, "k8s-leases", false, "Serve the Kubernetes coordination.k8s.io/v1 Lease API")
+	flag.BoolVar(&flagDotKeys, "dot-keys", false, "Split hierarchical lock keys by dots instead of slashes")
 	flag.BoolVar(&flagVers, "v", false, "Binary version")
 	flag.Parse()
 }
 
+func newLocker() (locker.Locker, error) {
+	switch flagBackend {
+	case "fs":
+		return locker.NewFsLocker(flagPath)
+	case "memory":
+		return locker.NewMemLocker(), nil
+	case "bolt":
+		return locker.NewBoltLocker(flagDB)
+	case "sqlite":
+		return locker.NewSQLiteLocker(flagDB)
+	case "redis":
+		return locker.NewRedisLocker(flagRedis)
+	case "postgres":
+		return locker.NewPostgresLocker(flagPgDSN)
+	case "etcd":
+		return locker.NewEtcdLocker(strings.Split(flagEtcd, ","))
+	case "raft":
+		peers, err := cluster.ParsePeers(flagPeers)
+		if err != nil {
+			return nil, err
+		}
+		return cluster.NewNode(cluster.Config{
+			ID:        flagRaftID,
+			Dir:       flagRaftDir,
+			Peers:     peers,
+			Bootstrap: flagBoot,
+		})
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", flagBackend)
+	}
+}
+
 func main() {
 	if flagVers {
 		fmt.Printf("%s %s (%s %s)\n", build.Name, build.Version, build.Date, build.Revision)
 		os.Exit(0)
 	}
 
-	locker, err := locker.NewFsLocker(flagPath)
+	locker, err := newLocker()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	server := api.NewServer(locker)
+	opts := []api.Option{api.WithMaxWaiters(flagWaiters)}
+	if flagLFS {
+		opts = append(opts, api.WithGitLFS())
+	}
+	if flagLeases {
+		opts = append(opts, api.WithKubernetesLeases())
+	}
+	if flagDotKeys {
+		opts = append(opts, api.WithDotKeyDelimiter())
+	}
+
+	server := api.NewServer(locker, opts...)
+
+	if flagGRPC != "" {
+		go func() {
+			log.Printf("Serving gRPC on %s\n", flagGRPC)
+			if err := server.ListenAndServeGRPC(flagGRPC); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if flagRESP != "" {
+		go func() {
+			log.Printf("Serving Redis protocol on %s\n", flagRESP)
+			if err := server.ListenAndServeRESP(flagRESP); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
 
 	log.Printf("Listening on %s\n", flagAddr)
 	if err := server.ListenAndServe(flagAddr); err != nil {
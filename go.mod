@@ -2,4 +2,17 @@ module github.com/laurynasgadl/lockronomicon
 
 go 1.16
 
-require github.com/gorilla/mux v1.8.0
+require (
+	github.com/alicebob/miniredis/v2 v2.14.3
+	github.com/go-redis/redis/v8 v8.11.4
+	github.com/gorilla/mux v1.8.0
+	github.com/hashicorp/raft v1.3.11
+	github.com/hashicorp/raft-boltdb/v2 v2.2.2
+	github.com/lib/pq v1.10.2
+	go.etcd.io/bbolt v1.3.6
+	go.etcd.io/etcd/client/v3 v3.5.0
+	go.etcd.io/etcd/server/v3 v3.5.0
+	google.golang.org/grpc v1.38.0
+	google.golang.org/protobuf v1.26.0
+	modernc.org/sqlite v1.14.6
+)
@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+const (
+	opLock          = "lock"
+	opLockShared    = "lock_shared"
+	opLockAnnotated = "lock_annotated"
+	opRefresh       = "refresh"
+	opRelease       = "release"
+	opSwap          = "swap"
+)
+
+// command is a single lock state change replicated through the raft log,
+// the time is set by the leader so that every node computes the same expiry
+type command struct {
+	Op         string `json:"op"`
+	Key        string `json:"key"`
+	Owner      string `json:"owner,omitempty"`
+	Generation int64  `json:"generation,omitempty"`
+	TTL        int64  `json:"ttl,omitempty"`
+	Now        int64  `json:"now"`
+}
+
+type commandResult struct {
+	Generation int64
+	Err        error
+}
+
+// fsm applies committed commands to the replicated lock state, the
+// raft log index of the command is used as the generation number
+type fsm struct {
+	mu    sync.Mutex
+	locks *locker.Table
+}
+
+func newFSM() *fsm {
+	return &fsm{
+		locks: locker.NewTable(),
+	}
+}
+
+func (f *fsm) Apply(log *raft.Log) interface{} {
+	var cmd command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return &commandResult{Err: locker.ErrDecodeMetadata}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Unix(cmd.Now, 0)
+	index := func() (int64, error) {
+		return int64(log.Index), nil
+	}
+
+	var gen int64
+	var err error
+
+	switch cmd.Op {
+	case opLock, opLockShared, opLockAnnotated:
+		ttl := time.Duration(cmd.TTL) * time.Second
+		gen, err = f.locks.Lock(cmd.Key, cmd.Op == opLockShared, cmd.Owner, cmd.Op == opLock, ttl, now, index)
+	case opRefresh:
+		gen, err = f.locks.Refresh(cmd.Key, cmd.Generation, now, index)
+	case opRelease:
+		err = f.locks.Release(cmd.Key, cmd.Generation, now)
+	case opSwap:
+		ttl := time.Duration(cmd.TTL) * time.Second
+		gen, err = f.locks.Swap(cmd.Key, cmd.Generation, cmd.Owner, ttl, now, index)
+	default:
+		err = locker.ErrDecodeMetadata
+	}
+
+	return &commandResult{Generation: gen, Err: err}
+}
+
+// expired reports the expiry of the lock as seen by this node
+func (f *fsm) expired(key string) (int64, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.locks.Expired(key, time.Now())
+}
+
+// get describes the lock as seen by this node
+func (f *fsm) get(key string) (*locker.LockInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.locks.Get(key)
+}
+
+// list lists the locks as seen by this node
+func (f *fsm) list(prefix string, after string, limit int) ([]*locker.LockInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.locks.List(prefix, after, limit)
+}
+
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &fsmSnapshot{locks: f.locks.Clone()}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	locks := locker.NewTable()
+	if err := json.NewDecoder(rc).Decode(locks); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.locks = locks
+	f.mu.Unlock()
+
+	return nil
+}
+
+type fsmSnapshot struct {
+	locks *locker.Table
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := json.NewEncoder(sink).Encode(s.locks)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
@@ -0,0 +1,325 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+const applyTimeout = 5 * time.Second
+
+// Peer is a single member of the cluster
+type Peer struct {
+	ID       string
+	RaftAddr string
+	APIAddr  string
+}
+
+// ParsePeers parses a comma separated list of id=raftAddr=apiAddr peers
+func ParsePeers(s string) ([]Peer, error) {
+	var peers []Peer
+
+	for _, p := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(p), "=")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid peer %q, expected id=raftAddr=apiAddr", p)
+		}
+
+		peers = append(peers, Peer{
+			ID:       parts[0],
+			RaftAddr: parts[1],
+			APIAddr:  parts[2],
+		})
+	}
+
+	return peers, nil
+}
+
+type Config struct {
+	// ID of this node, must be one of the peer IDs
+	ID string
+
+	// Dir keeps the raft log and snapshots, state is
+	// kept in memory only if it is empty
+	Dir string
+
+	// Peers lists every member of the cluster including this node
+	Peers []Peer
+
+	// Bootstrap the cluster with Peers as its initial configuration,
+	// it is safe to bootstrap every node with the same peer list
+	Bootstrap bool
+
+	// LogOutput receives raft logs, defaults to stderr
+	LogOutput io.Writer
+}
+
+// Node is a member of a raft replicated lock service. Lock state changes
+// are only accepted by the leader, other nodes return locker.ErrNotLeader
+type Node struct {
+	id        string
+	raft      *raft.Raft
+	fsm       *fsm
+	transport *raft.NetworkTransport
+	store     *raftboltdb.BoltStore
+	peers     []Peer
+}
+
+func NewNode(cfg Config) (*Node, error) {
+	var self *Peer
+	for i := range cfg.Peers {
+		if cfg.Peers[i].ID == cfg.ID {
+			self = &cfg.Peers[i]
+		}
+	}
+
+	if self == nil {
+		return nil, fmt.Errorf("node %q is not one of the peers", cfg.ID)
+	}
+
+	logOutput := cfg.LogOutput
+	if logOutput == nil {
+		logOutput = os.Stderr
+	}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.ID)
+	conf.LogOutput = logOutput
+	conf.LogLevel = "WARN"
+
+	addr, err := net.ResolveTCPAddr("tcp", self.RaftAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := raft.NewTCPTransport(self.RaftAddr, addr, 3, 10*time.Second, logOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
+		id:        cfg.ID,
+		fsm:       newFSM(),
+		transport: transport,
+		peers:     cfg.Peers,
+	}
+
+	var logs raft.LogStore
+	var stable raft.StableStore
+	var snaps raft.SnapshotStore
+
+	if cfg.Dir == "" {
+		store := raft.NewInmemStore()
+		logs, stable = store, store
+		snaps = raft.NewInmemSnapshotStore()
+	} else {
+		err = os.MkdirAll(cfg.Dir, os.ModePerm)
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+
+		n.store, err = raftboltdb.NewBoltStore(filepath.Join(cfg.Dir, "raft.db"))
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+		logs, stable = n.store, n.store
+
+		snaps, err = raft.NewFileSnapshotStore(cfg.Dir, 2, logOutput)
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+
+	n.raft, err = raft.NewRaft(conf, n.fsm, logs, stable, snaps, transport)
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+
+	if cfg.Bootstrap {
+		var servers []raft.Server
+		for _, p := range cfg.Peers {
+			servers = append(servers, raft.Server{
+				ID:      raft.ServerID(p.ID),
+				Address: raft.ServerAddress(p.RaftAddr),
+			})
+		}
+
+		err = n.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+		if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+			n.Close()
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+func (n *Node) Close() error {
+	if n.raft != nil {
+		n.raft.Shutdown().Error()
+	}
+
+	if n.store != nil {
+		n.store.Close()
+	}
+
+	return n.transport.Close()
+}
+
+// IsLeader reports whether this node currently accepts lock state changes
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// LeaderAPIAddr returns the API address of the current
+// leader if it is known and is not this node
+func (n *Node) LeaderAPIAddr() (string, bool) {
+	if n.IsLeader() {
+		return "", false
+	}
+
+	_, id := n.raft.LeaderWithID()
+	for _, p := range n.peers {
+		if raft.ServerID(p.ID) == id {
+			return p.APIAddr, true
+		}
+	}
+
+	return "", false
+}
+
+func (n *Node) Lock(key string, ttl time.Duration) (int64, error) {
+	return n.apply(&command{
+		Op:  opLock,
+		Key: key,
+		TTL: locker.NewMetadata(ttl).TTL,
+	})
+}
+
+func (n *Node) LockShared(key string, ttl time.Duration) (int64, error) {
+	return n.apply(&command{
+		Op:  opLockShared,
+		Key: key,
+		TTL: locker.NewMetadata(ttl).TTL,
+	})
+}
+
+func (n *Node) LockOwned(key string, owner string, ttl time.Duration) (int64, error) {
+	return n.apply(&command{
+		Op:    opLock,
+		Key:   key,
+		Owner: owner,
+		TTL:   locker.NewMetadata(ttl).TTL,
+	})
+}
+
+func (n *Node) LockAnnotated(key string, annotation string, ttl time.Duration) (int64, error) {
+	return n.apply(&command{
+		Op:    opLockAnnotated,
+		Key:   key,
+		Owner: annotation,
+		TTL:   locker.NewMetadata(ttl).TTL,
+	})
+}
+
+func (n *Node) Refresh(key string, generation int64) (int64, error) {
+	return n.apply(&command{
+		Op:         opRefresh,
+		Key:        key,
+		Generation: generation,
+	})
+}
+
+func (n *Node) Release(key string, generation int64) error {
+	_, err := n.apply(&command{
+		Op:         opRelease,
+		Key:        key,
+		Generation: generation,
+	})
+	return err
+}
+
+func (n *Node) Swap(key string, generation int64, owner string, ttl time.Duration) (int64, error) {
+	return n.apply(&command{
+		Op:         opSwap,
+		Key:        key,
+		Owner:      owner,
+		Generation: generation,
+		TTL:        locker.NewMetadata(ttl).TTL,
+	})
+}
+
+func (n *Node) Expired(key string) (int64, bool, error) {
+	// make sure the local state is not stale
+	if n.raft.VerifyLeader().Error() != nil {
+		return 0, false, locker.ErrNotLeader
+	}
+
+	return n.fsm.expired(key)
+}
+
+func (n *Node) Get(key string) (*locker.LockInfo, error) {
+	// make sure the local state is not stale
+	if n.raft.VerifyLeader().Error() != nil {
+		return nil, locker.ErrNotLeader
+	}
+
+	return n.fsm.get(key)
+}
+
+func (n *Node) List(prefix string, after string, limit int) ([]*locker.LockInfo, error) {
+	// make sure the local state is not stale
+	if n.raft.VerifyLeader().Error() != nil {
+		return nil, locker.ErrNotLeader
+	}
+
+	return n.fsm.list(prefix, after, limit)
+}
+
+func (n *Node) Hierarchical() bool {
+	return true
+}
+
+func (n *Node) apply(cmd *command) (int64, error) {
+	if !n.IsLeader() {
+		return 0, locker.ErrNotLeader
+	}
+
+	cmd.Now = time.Now().Unix()
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return 0, locker.ErrEncodeMetadata
+	}
+
+	future := n.raft.Apply(data, applyTimeout)
+	if err := future.Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return 0, locker.ErrNotLeader
+		}
+		return 0, locker.ErrWriteMetadata
+	}
+
+	res := future.Response().(*commandResult)
+	return res.Generation, res.Err
+}
+
+// compile time check to ensure interface implementation
+var _ locker.SharedLocker = &Node{}
+var _ locker.HierarchicalLocker = &Node{}
+var _ locker.ReentrantLocker = &Node{}
+var _ locker.AnnotatedLocker = &Node{}
+var _ locker.SwappingLocker = &Node{}
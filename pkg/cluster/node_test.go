@@ -0,0 +1,217 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/laurynasgadl/lockronomicon/pkg/locker"
+)
+
+func freeLocalAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func execClusterTest(t *testing.T, size int, fn func(nodes []*Node)) {
+	var peers []Peer
+	for i := 0; i < size; i++ {
+		peers = append(peers, Peer{
+			ID:       fmt.Sprintf("node%d", i),
+			RaftAddr: freeLocalAddr(t),
+			APIAddr:  fmt.Sprintf("api%d:80", i),
+		})
+	}
+
+	var nodes []*Node
+	for _, p := range peers {
+		n, err := NewNode(Config{
+			ID:        p.ID,
+			Peers:     peers,
+			Bootstrap: true,
+			LogOutput: io.Discard,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer n.Close()
+
+		nodes = append(nodes, n)
+	}
+
+	fn(nodes)
+}
+
+func waitForLeader(t *testing.T, nodes []*Node) *Node {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, n := range nodes {
+			if n.IsLeader() {
+				return n
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("no leader elected")
+	return nil
+}
+
+func TestClusterLockIsReplicated(t *testing.T) {
+	execClusterTest(t, 3, func(nodes []*Node) {
+		leader := waitForLeader(t, nodes)
+		key := "test.key"
+
+		gn, err := leader.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Fatalf("cluster lock unexpected error: %v", err)
+		}
+
+		_, err = leader.Lock(key, 100*time.Second)
+		if !errors.Is(err, locker.ErrLockTaken) {
+			t.Errorf("cluster expected lock taken error")
+		}
+
+		// wait for the followers to apply the log entry
+		deadline := time.Now().Add(5 * time.Second)
+		for _, n := range nodes {
+			for {
+				gen, _, err := n.fsm.expired(key)
+				if err == nil && gen == gn {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("lock not replicated to all nodes")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	})
+}
+
+func TestClusterFollowersRejectChanges(t *testing.T) {
+	execClusterTest(t, 3, func(nodes []*Node) {
+		leader := waitForLeader(t, nodes)
+
+		for _, n := range nodes {
+			if n == leader {
+				continue
+			}
+
+			_, err := n.Lock("test.key", 100*time.Second)
+			if !errors.Is(err, locker.ErrNotLeader) {
+				t.Errorf("cluster expected not leader error, received %v", err)
+			}
+
+			addr, ok := n.LeaderAPIAddr()
+			if !ok {
+				t.Errorf("cluster follower does not know the leader")
+			}
+
+			for _, p := range leader.peers {
+				if p.ID == leader.id && p.APIAddr != addr {
+					t.Errorf("expected leader API address %s, received %s", p.APIAddr, addr)
+				}
+			}
+		}
+	})
+}
+
+func TestClusterSurvivesLeaderFailure(t *testing.T) {
+	execClusterTest(t, 3, func(nodes []*Node) {
+		leader := waitForLeader(t, nodes)
+		key := "test.key"
+
+		gn, err := leader.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Fatalf("cluster lock unexpected error: %v", err)
+		}
+
+		// make sure the entry is committed on every node before failing the leader
+		if err := leader.raft.Barrier(5 * time.Second).Error(); err != nil {
+			t.Fatalf("cluster barrier unexpected error: %v", err)
+		}
+		leader.Close()
+
+		var rest []*Node
+		for _, n := range nodes {
+			if n != leader {
+				rest = append(rest, n)
+			}
+		}
+
+		leader = waitForLeader(t, rest)
+
+		gn2, err := leader.Refresh(key, gn)
+		if err != nil {
+			t.Fatalf("cluster refresh unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("cluster refresh returned non-increasing generation number: %d", gn2)
+		}
+
+		err = leader.Release(key, gn2)
+		if err != nil {
+			t.Errorf("cluster release unexpected error: %v", err)
+		}
+	})
+}
+
+func TestParsePeers(t *testing.T) {
+	peers, err := ParsePeers("n1=10.0.0.1:7000=10.0.0.1:80,n2=10.0.0.2:7000=10.0.0.2:80")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(peers) != 2 || peers[1].ID != "n2" || peers[1].RaftAddr != "10.0.0.2:7000" || peers[1].APIAddr != "10.0.0.2:80" {
+		t.Errorf("unexpected peers parsed: %v", peers)
+	}
+
+	_, err = ParsePeers("n1=10.0.0.1:7000")
+	if err == nil {
+		t.Errorf("expected error for peer without API address")
+	}
+}
+
+func TestClusterSharedLocks(t *testing.T) {
+	execClusterTest(t, 3, func(nodes []*Node) {
+		leader := waitForLeader(t, nodes)
+		key := "test.key"
+
+		gn, err := leader.LockShared(key, 100*time.Second)
+		if err != nil {
+			t.Fatalf("cluster lock shared unexpected error: %v", err)
+		}
+
+		gn2, err := leader.LockShared(key, 100*time.Second)
+		if err != nil {
+			t.Fatalf("cluster lock shared unexpected error: %v", err)
+		}
+
+		_, err = leader.Lock(key, 100*time.Second)
+		if !errors.Is(err, locker.ErrLockTaken) {
+			t.Errorf("cluster expected lock taken error")
+		}
+
+		for _, g := range []int64{gn, gn2} {
+			err = leader.Release(key, g)
+			if err != nil {
+				t.Errorf("cluster release unexpected error: %v", err)
+			}
+		}
+
+		_, err = leader.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("cluster lock unexpected error: %v", err)
+		}
+	})
+}
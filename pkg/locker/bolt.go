@@ -0,0 +1,309 @@
+package locker
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltLocksBucket = []byte("locks")
+
+// BoltLocker keeps every lock as a single record in an embedded
+// B+tree database file, so acquire, refresh and release are atomic
+type BoltLocker struct {
+	db *bolt.DB
+}
+
+func NewBoltLocker(path string) (*BoltLocker, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltLocksBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltLocker{
+		db: db,
+	}, nil
+}
+
+func (b *BoltLocker) Close() error {
+	return b.db.Close()
+}
+
+func (b *BoltLocker) Lock(key string, ttl time.Duration) (int64, error) {
+	return b.lock(key, false, "", false, ttl)
+}
+
+func (b *BoltLocker) LockShared(key string, ttl time.Duration) (int64, error) {
+	return b.lock(key, true, "", false, ttl)
+}
+
+func (b *BoltLocker) LockOwned(key string, owner string, ttl time.Duration) (int64, error) {
+	return b.lock(key, false, owner, true, ttl)
+}
+
+func (b *BoltLocker) LockAnnotated(key string, annotation string, ttl time.Duration) (int64, error) {
+	return b.lock(key, false, annotation, false, ttl)
+}
+
+func (b *BoltLocker) lock(key string, shared bool, owner string, reentrant bool, ttl time.Duration) (int64, error) {
+	var gen int64
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := boltStore{tx.Bucket(boltLocksBucket)}
+
+		var err error
+		gen, err = takeLock(bucket, key, shared, owner, reentrant, ttl, time.Now(), boltSequence(bucket.Bucket))
+		return err
+	})
+	if err != nil {
+		return 0, boltError(err, ErrWriteMetadata)
+	}
+
+	return gen, nil
+}
+
+func (b *BoltLocker) Refresh(key string, generation int64) (int64, error) {
+	var gen int64
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := boltStore{tx.Bucket(boltLocksBucket)}
+
+		record, err := bucket.getRecord(key)
+		if err != nil {
+			return err
+		}
+
+		gen, err = record.refresh(generation, time.Now(), boltSequence(bucket.Bucket))
+		if err != nil {
+			return err
+		}
+
+		return bucket.putRecord(key, record)
+	})
+	if err != nil {
+		return 0, boltError(err, ErrWriteMetadata)
+	}
+
+	return gen, nil
+}
+
+func (b *BoltLocker) Release(key string, generation int64) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := boltStore{tx.Bucket(boltLocksBucket)}
+
+		record, err := bucket.getRecord(key)
+		if err != nil {
+			return err
+		}
+
+		released, err := record.release(generation, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if !released {
+			return bucket.putRecord(key, record)
+		}
+
+		return bucket.removeRecord(key)
+	})
+
+	return boltError(err, ErrRemoveLock)
+}
+
+func (b *BoltLocker) Swap(key string, generation int64, owner string, ttl time.Duration) (int64, error) {
+	var gen int64
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := boltStore{tx.Bucket(boltLocksBucket)}
+
+		record, err := bucket.getRecord(key)
+		if err != nil {
+			return err
+		}
+
+		gen, err = record.swap(generation, owner, ttl, time.Now(), boltSequence(bucket.Bucket))
+		if err != nil {
+			return err
+		}
+
+		return bucket.putRecord(key, record)
+	})
+	if err != nil {
+		return 0, boltError(err, ErrWriteMetadata)
+	}
+
+	return gen, nil
+}
+
+func (b *BoltLocker) Expired(key string) (int64, bool, error) {
+	var record *lockRecord
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = boltStore{tx.Bucket(boltLocksBucket)}.getRecord(key)
+		return err
+	})
+	if err != nil {
+		return 0, false, boltError(err, ErrReadLock)
+	}
+
+	gen, expired := record.expiry(time.Now())
+	return gen, expired, nil
+}
+
+func (b *BoltLocker) Get(key string) (*LockInfo, error) {
+	var record *lockRecord
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = boltStore{tx.Bucket(boltLocksBucket)}.getRecord(key)
+		return err
+	})
+	if err != nil {
+		return nil, boltError(err, ErrReadLock)
+	}
+
+	return record.info(key), nil
+}
+
+func (b *BoltLocker) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	var locks []*LockInfo
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		start := []byte(prefix)
+		if after != "" && after >= prefix {
+			// the smallest key sorted after the given one
+			start = []byte(after + "\x00")
+		}
+
+		c := tx.Bucket(boltLocksBucket).Cursor()
+		k, v := c.Seek(start)
+		for k != nil && bytes.HasPrefix(k, []byte(prefix)) && len(locks) < limit {
+			if skipsInternalKey(prefix, string(k)) {
+				// internal keys are sorted next to each other
+				k, v = c.Seek([]byte(internalKeysEnd))
+				continue
+			}
+
+			record, err := parseLockRecord(v)
+			if err != nil {
+				return ErrDecodeMetadata
+			}
+			locks = append(locks, record.info(string(k)))
+
+			k, v = c.Next()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, boltError(err, ErrReadLock)
+	}
+
+	return locks, nil
+}
+
+func (b *BoltLocker) Hierarchical() bool {
+	return true
+}
+
+// boltSequence returns a generation number source backed by the bucket sequence
+func boltSequence(bucket *bolt.Bucket) func() (int64, error) {
+	return func() (int64, error) {
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return 0, ErrWriteMetadata
+		}
+		return int64(seq), nil
+	}
+}
+
+// boltStore keeps the lock records in a bucket of an open transaction
+type boltStore struct {
+	*bolt.Bucket
+}
+
+func (b boltStore) getRecord(key string) (*lockRecord, error) {
+	data := b.Get([]byte(key))
+	if data == nil {
+		return nil, ErrLockNotExist
+	}
+
+	record, err := parseLockRecord(data)
+	if err != nil {
+		return nil, ErrDecodeMetadata
+	}
+
+	return record, nil
+}
+
+func (b boltStore) putRecord(key string, record *lockRecord) error {
+	data, err := record.Encode()
+	if err != nil {
+		return ErrEncodeMetadata
+	}
+
+	if b.Put([]byte(key), data) != nil {
+		return ErrWriteMetadata
+	}
+
+	return nil
+}
+
+func (b boltStore) removeRecord(key string) error {
+	if b.Delete([]byte(key)) != nil {
+		return ErrRemoveLock
+	}
+
+	return nil
+}
+
+func (b boltStore) descendantRecords(key string, fn func(key string, record *lockRecord)) error {
+	prefix := []byte(key + KeyDelimiter)
+
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		record, err := parseLockRecord(v)
+		if err != nil {
+			return ErrDecodeMetadata
+		}
+		fn(string(k), record)
+	}
+
+	return nil
+}
+
+// boltError passes locker errors through and replaces
+// database errors (e.g. failed commits) with the fallback
+func boltError(err error, fallback error) error {
+	if err == nil {
+		return nil
+	}
+
+	for _, e := range []error{
+		ErrLockTaken,
+		ErrLockNotExist,
+		ErrGenNumberMismatch,
+		ErrEncodeMetadata,
+		ErrDecodeMetadata,
+		ErrWriteMetadata,
+		ErrRemoveLock,
+	} {
+		if errors.Is(err, e) {
+			return err
+		}
+	}
+
+	return fallback
+}
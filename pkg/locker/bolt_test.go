@@ -0,0 +1,307 @@
+package locker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func execBoltTest(t *testing.T, fn func(l *BoltLocker)) {
+	dir, err := os.MkdirTemp("", "locker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	locker, err := NewBoltLocker(filepath.Join(dir, "locks.db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer locker.Close()
+
+	fn(locker)
+}
+
+func TestBoltLockPreventsConsecutiveLock(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("bolt locker expected lock taken error")
+		}
+	})
+}
+
+func TestBoltReleaseAllowsConsecutiveLocks(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("bolt locker release unexpected error: %v", err)
+		}
+
+		gn2, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("bolt locker lock returned non-increasing generation number: %d", gn2)
+		}
+	})
+}
+
+func TestBoltReleaseFailsOnGenerationNumberMismatch(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn+10)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("bolt locker expected generation number mismatch error")
+		}
+	})
+}
+
+func TestBoltRefreshReturnsValidNewGenerationNumber(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		gn2, err := l.Refresh(key, gn)
+		if err != nil {
+			t.Errorf("bolt locker refresh unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("bolt locker refresh returned non-increasing generation number: %d", gn2)
+		}
+
+		_, err = l.Refresh(key, gn)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("bolt locker expected generation number mismatch error")
+		}
+	})
+}
+
+func TestBoltRefreshFailsOnNonExistingLock(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		_, err := l.Refresh("test.key", 1)
+		if !errors.Is(err, ErrLockNotExist) {
+			t.Errorf("bolt locker expected lock not exist error")
+		}
+	})
+}
+
+func TestBoltRecognizesExpiredLock(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 0)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		gn2, exp, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("bolt locker expired unexpected error: %v", err)
+		}
+
+		if !exp {
+			t.Errorf("expected lock to be expired")
+		}
+
+		if gn != gn2 {
+			t.Errorf("expected generation number %d, received %d", gn, gn2)
+		}
+	})
+}
+
+func TestBoltPersistsLocksAcrossReopen(t *testing.T) {
+	dir, err := os.MkdirTemp("", "locker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "locks.db")
+	key := "test.key"
+
+	l, err := NewBoltLocker(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gn, err := l.Lock(key, -1*time.Second)
+	if err != nil {
+		t.Errorf("bolt locker lock unexpected error: %v", err)
+	}
+	l.Close()
+
+	l, err = NewBoltLocker(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	err = l.Release(key, gn)
+	if err != nil {
+		t.Errorf("bolt locker release unexpected error: %v", err)
+	}
+}
+
+func TestBoltSharedLocksCoexist(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		key := "test.key"
+
+		gn, err := l.LockShared(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock shared unexpected error: %v", err)
+		}
+
+		gn2, err := l.LockShared(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock shared unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("bolt locker expected lock taken error")
+		}
+
+		for _, g := range []int64{gn, gn2} {
+			err = l.Release(key, g)
+			if err != nil {
+				t.Errorf("bolt locker release unexpected error: %v", err)
+			}
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+	})
+}
+
+func TestBoltHierarchicalLocksConflict(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		gn, err := l.Lock("tenant1", 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Lock("tenant1/db", 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("bolt locker expected lock taken error")
+		}
+
+		_, err = l.Lock("tenant10/db", 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release("tenant1", gn)
+		if err != nil {
+			t.Errorf("bolt locker release unexpected error: %v", err)
+		}
+
+		_, err = l.Lock("tenant1/db", 100*time.Second)
+		if err != nil {
+			t.Errorf("bolt locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Lock("tenant1", 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("bolt locker expected lock taken error")
+		}
+	})
+}
+
+func TestBoltListPagesThroughLocks(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		for _, key := range []string{"db.users", "db.orders", "cache.sessions", "db.accounts"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("bolt locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("db.", "", 2)
+		if err != nil {
+			t.Errorf("bolt locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "db.accounts" || locks[1].Key != "db.orders" {
+			t.Fatalf("bolt locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("db.", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("bolt locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "db.users" || len(locks[0].Holders) != 1 {
+			t.Errorf("bolt locker unexpected second page: %+v", locks)
+		}
+	})
+}
+
+func TestBoltListSkipsInternalLocks(t *testing.T) {
+	execBoltTest(t, func(l *BoltLocker) {
+		for _, key := range []string{"a", "@semaphore.db@1.0", "0", "@lfs.repo@1", "Z"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("bolt locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("", "", 2)
+		if err != nil {
+			t.Errorf("bolt locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "0" || locks[1].Key != "Z" {
+			t.Fatalf("bolt locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("bolt locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "a" {
+			t.Errorf("bolt locker unexpected second page: %+v", locks)
+		}
+
+		locks, err = l.List(InternalKeyPrefix, "", 10)
+		if err != nil {
+			t.Errorf("bolt locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "@lfs.repo@1" || locks[1].Key != "@semaphore.db@1.0" {
+			t.Errorf("bolt locker unexpected internal locks: %+v", locks)
+		}
+	})
+}
@@ -13,4 +13,7 @@ var (
 	ErrReadMetadata      = errors.New("could not read metadata")
 	ErrRemoveMetadata    = errors.New("could not remove metadata")
 	ErrGenNumberMismatch = errors.New("generation number mismatch")
+	ErrNotLeader         = errors.New("not the cluster leader")
+	ErrNotSupported      = errors.New("not supported by the locker")
+	ErrLockerInUse       = errors.New("locker directory is used by another process")
 )
@@ -0,0 +1,271 @@
+package locker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const etcdKeyPrefix = "/lockronomicon/locks/"
+
+// EtcdLocker keeps locks as etcd keys attached to a lease, the mod
+// revision of the key is used as the generation number which makes
+// it a cluster wide monotonic fencing token
+type EtcdLocker struct {
+	client *clientv3.Client
+}
+
+func NewEtcdLocker(endpoints []string) (*EtcdLocker, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &EtcdLocker{
+		client: client,
+	}, nil
+}
+
+func (e *EtcdLocker) Close() error {
+	return e.client.Close()
+}
+
+func (e *EtcdLocker) Lock(key string, ttl time.Duration) (int64, error) {
+	ctx := context.Background()
+	path := etcdKeyPrefix + key
+
+	md := NewMetadata(ttl)
+	metadata, err := md.Encode()
+	if err != nil {
+		return 0, ErrEncodeMetadata
+	}
+
+	opts := []clientv3.OpOption{}
+	var lease clientv3.LeaseID
+
+	// immortal locks are not attached to a lease
+	if md.TTL >= 0 {
+		grant, err := e.client.Grant(ctx, md.TTL)
+		if err != nil {
+			return 0, ErrWriteMetadata
+		}
+		lease = grant.ID
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+
+	resp, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(path), "=", 0)).
+		Then(clientv3.OpPut(path, string(metadata), opts...)).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		if lease != clientv3.NoLease {
+			e.client.Revoke(ctx, lease)
+		}
+		if err != nil {
+			return 0, ErrWriteMetadata
+		}
+		return 0, ErrLockTaken
+	}
+
+	return resp.Header.Revision, nil
+}
+
+func (e *EtcdLocker) Refresh(key string, generation int64) (int64, error) {
+	ctx := context.Background()
+	path := etcdKeyPrefix + key
+
+	resp, err := e.client.Get(ctx, path)
+	if err != nil {
+		return 0, ErrReadLock
+	}
+
+	if len(resp.Kvs) == 0 {
+		return 0, ErrLockNotExist
+	}
+
+	kv := resp.Kvs[0]
+	if generation != kv.ModRevision {
+		return 0, ErrGenNumberMismatch
+	}
+
+	md, err := ParseMetadata(kv.Value)
+	if err != nil {
+		return 0, ErrDecodeMetadata
+	}
+
+	renewed := NewMetadata(time.Duration(md.TTL) * time.Second)
+	renewed.Acquired = md.Acquired
+
+	metadata, err := renewed.Encode()
+	if err != nil {
+		return 0, ErrEncodeMetadata
+	}
+
+	opts := []clientv3.OpOption{}
+	lease := clientv3.LeaseID(kv.Lease)
+
+	if lease != clientv3.NoLease {
+		_, err = e.client.KeepAliveOnce(ctx, lease)
+		if err != nil {
+			// lease has already expired together with the lock
+			return 0, ErrLockNotExist
+		}
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+
+	// rewrite the key to bump its mod revision
+	txn, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(path), "=", generation)).
+		Then(clientv3.OpPut(path, string(metadata), opts...)).
+		Commit()
+	if err != nil {
+		return 0, ErrWriteMetadata
+	}
+
+	if !txn.Succeeded {
+		return 0, ErrGenNumberMismatch
+	}
+
+	return txn.Header.Revision, nil
+}
+
+func (e *EtcdLocker) Release(key string, generation int64) error {
+	ctx := context.Background()
+	path := etcdKeyPrefix + key
+
+	resp, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(path), "=", generation)).
+		Then(clientv3.OpGet(path), clientv3.OpDelete(path)).
+		Else(clientv3.OpGet(path)).
+		Commit()
+	if err != nil {
+		return ErrRemoveLock
+	}
+
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		return ErrLockNotExist
+	}
+
+	if !resp.Succeeded {
+		return ErrGenNumberMismatch
+	}
+
+	if lease := clientv3.LeaseID(kvs[0].Lease); lease != clientv3.NoLease {
+		e.client.Revoke(ctx, lease)
+	}
+
+	return nil
+}
+
+func (e *EtcdLocker) Expired(key string) (int64, bool, error) {
+	resp, err := e.client.Get(context.Background(), etcdKeyPrefix+key)
+	if err != nil {
+		return 0, false, ErrReadLock
+	}
+
+	if len(resp.Kvs) == 0 {
+		return 0, false, ErrLockNotExist
+	}
+
+	md, err := ParseMetadata(resp.Kvs[0].Value)
+	if err != nil {
+		return 0, false, ErrDecodeMetadata
+	}
+
+	return resp.Kvs[0].ModRevision, md.Expired(), nil
+}
+
+func (e *EtcdLocker) Get(key string) (*LockInfo, error) {
+	resp, err := e.client.Get(context.Background(), etcdKeyPrefix+key)
+	if err != nil {
+		return nil, ErrReadLock
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, ErrLockNotExist
+	}
+
+	md, err := ParseMetadata(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, ErrDecodeMetadata
+	}
+
+	return &LockInfo{
+		Key: key,
+		Holders: []Holder{{
+			Generation: resp.Kvs[0].ModRevision,
+			Metadata:   *md,
+		}},
+	}, nil
+}
+
+func (e *EtcdLocker) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	start := etcdKeyPrefix + prefix
+	if after != "" && after >= prefix {
+		// the smallest key sorted after the given one
+		start = etcdKeyPrefix + after + "\x00"
+	}
+	end := clientv3.GetPrefixRangeEnd(etcdKeyPrefix + prefix)
+
+	// internal keys are sorted next to each other, so they are skipped
+	// by listing the keys before and after them
+	ranges := [][2]string{{start, end}}
+	if !IsInternalKey(prefix) {
+		ranges = [][2]string{
+			{start, minKey(end, etcdKeyPrefix+InternalKeyPrefix)},
+			{maxKey(start, etcdKeyPrefix+internalKeysEnd), end},
+		}
+	}
+
+	var locks []*LockInfo
+	for _, r := range ranges {
+		if r[0] >= r[1] || len(locks) == limit {
+			continue
+		}
+
+		resp, err := e.client.Get(context.Background(), r[0],
+			clientv3.WithRange(r[1]),
+			clientv3.WithLimit(int64(limit-len(locks))),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+		)
+		if err != nil {
+			return nil, ErrReadLock
+		}
+
+		for _, kv := range resp.Kvs {
+			md, err := ParseMetadata(kv.Value)
+			if err != nil {
+				return nil, ErrDecodeMetadata
+			}
+
+			locks = append(locks, &LockInfo{
+				Key: strings.TrimPrefix(string(kv.Key), etcdKeyPrefix),
+				Holders: []Holder{{
+					Generation: kv.ModRevision,
+					Metadata:   *md,
+				}},
+			})
+		}
+	}
+	return locks, nil
+}
+
+func minKey(a string, b string) string {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxKey(a string, b string) string {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,283 @@
+package locker
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func freeLocalURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func execEtcdTest(t *testing.T, fn func(l *EtcdLocker)) {
+	dir, err := os.MkdirTemp("", "etcd")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientURL, peerURL := freeLocalURL(t), freeLocalURL(t)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	srv, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer srv.Close()
+
+	select {
+	case <-srv.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("etcd server took too long to start")
+	}
+
+	locker, err := NewEtcdLocker([]string{clientURL.String()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer locker.Close()
+
+	fn(locker)
+}
+
+func TestEtcdLockPreventsConsecutiveLock(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("etcd locker expected lock taken error")
+		}
+	})
+}
+
+func TestEtcdReleaseAllowsConsecutiveLocks(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("etcd locker release unexpected error: %v", err)
+		}
+
+		gn2, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("etcd locker lock returned non-increasing generation number: %d", gn2)
+		}
+	})
+}
+
+func TestEtcdReleaseFailsOnGenerationNumberMismatch(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn+10)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("etcd locker expected generation number mismatch error")
+		}
+
+		err = l.Release("other.key", gn)
+		if !errors.Is(err, ErrLockNotExist) {
+			t.Errorf("etcd locker expected lock not exist error")
+		}
+	})
+}
+
+func TestEtcdRefreshReturnsValidNewGenerationNumber(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		gn2, err := l.Refresh(key, gn)
+		if err != nil {
+			t.Errorf("etcd locker refresh unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("etcd locker refresh returned non-increasing generation number: %d", gn2)
+		}
+
+		_, err = l.Refresh(key, gn)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("etcd locker expected generation number mismatch error")
+		}
+
+		err = l.Release(key, gn2)
+		if err != nil {
+			t.Errorf("etcd locker release unexpected error: %v", err)
+		}
+	})
+}
+
+func TestEtcdRecognizesExpiredLock(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 0)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		_, exp, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("etcd locker expired unexpected error: %v", err)
+		}
+
+		if !exp {
+			t.Errorf("expected lock to be expired")
+		}
+	})
+}
+
+func TestEtcdRecognizesNeverExpiringLock(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, -1*time.Second)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		_, exp, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("etcd locker expired unexpected error: %v", err)
+		}
+
+		if exp {
+			t.Errorf("expected lock to be non-expired")
+		}
+
+		_, err = l.Refresh(key, gn)
+		if err != nil {
+			t.Errorf("etcd locker refresh unexpected error: %v", err)
+		}
+	})
+}
+
+func TestEtcdGetDescribesLock(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("etcd locker lock unexpected error: %v", err)
+		}
+
+		info, err := l.Get(key)
+		if err != nil {
+			t.Fatalf("etcd locker get unexpected error: %v", err)
+		}
+
+		if len(info.Holders) != 1 || info.Holders[0].Generation != gn || info.Holders[0].TTL != 100 {
+			t.Errorf("etcd locker unexpected lock description: %+v", info)
+		}
+	})
+}
+
+func TestEtcdListPagesThroughLocks(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		for _, key := range []string{"db.users", "db.orders", "cache.sessions", "db.accounts"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("etcd locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("db.", "", 2)
+		if err != nil {
+			t.Errorf("etcd locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "db.accounts" || locks[1].Key != "db.orders" {
+			t.Fatalf("etcd locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("db.", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("etcd locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "db.users" || len(locks[0].Holders) != 1 {
+			t.Errorf("etcd locker unexpected second page: %+v", locks)
+		}
+	})
+}
+
+func TestEtcdListSkipsInternalLocks(t *testing.T) {
+	execEtcdTest(t, func(l *EtcdLocker) {
+		for _, key := range []string{"a", "@semaphore.db@1.0", "0", "@lfs.repo@1", "Z"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("etcd locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("", "", 2)
+		if err != nil {
+			t.Errorf("etcd locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "0" || locks[1].Key != "Z" {
+			t.Fatalf("etcd locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("etcd locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "a" {
+			t.Errorf("etcd locker unexpected second page: %+v", locks)
+		}
+
+		locks, err = l.List(InternalKeyPrefix, "", 10)
+		if err != nil {
+			t.Errorf("etcd locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "@lfs.repo@1" || locks[1].Key != "@semaphore.db@1.0" {
+			t.Errorf("etcd locker unexpected internal locks: %+v", locks)
+		}
+	})
+}
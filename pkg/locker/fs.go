@@ -2,16 +2,39 @@ package locker
 
 import (
 	"encoding/json"
+	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-const metadataFilename = "metadata"
+const (
+	metadataFilename = "metadata"
 
+	// generationFilename and lockFilename can not clash with lock keys,
+	// '@' is not allowed in the keys sent to the API and the internal
+	// keys starting with InternalKeyPrefix are named after the APIs
+	// taking them, e.g. "@semaphore.", never "@generation" or "@lock"
+	generationFilename = "@generation"
+	lockFilename       = "@lock"
+)
+
+// FsLocker keeps every lock as a directory under rootDir. Generation
+// numbers come from a counter persisted in rootDir and lock state is
+// guarded by an in-process mutex. The locker holds a lock on a file in
+// rootDir for as long as it is open, so that a second process sharing
+// the directory fails to start instead of handing out the same locks
 type FsLocker struct {
-	rootDir string
+	rootDir  string
+	lockFile *os.File
+
+	mu         sync.Mutex
+	generation int64
 }
 
 func NewFsLocker(rootDir string) (*FsLocker, error) {
@@ -20,162 +43,412 @@ func NewFsLocker(rootDir string) (*FsLocker, error) {
 		return nil, err
 	}
 
-	return &FsLocker{
-		rootDir: rootDir,
-	}, nil
+	lockFile, err := lockDir(filepath.Join(rootDir, lockFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FsLocker{
+		rootDir:  rootDir,
+		lockFile: lockFile,
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootDir, generationFilename))
+	switch {
+	case err == nil:
+		fs.generation, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			lockFile.Close()
+			return nil, ErrReadMetadata
+		}
+	case os.IsNotExist(err):
+		// start above any mtime based generation handed out before the counter existed
+		fs.generation = time.Now().UnixNano()
+	default:
+		lockFile.Close()
+		return nil, ErrReadMetadata
+	}
+
+	return fs, nil
+}
+
+// Close lets another process use rootDir
+func (fs *FsLocker) Close() error {
+	return fs.lockFile.Close()
 }
 
 func (fs *FsLocker) Lock(key string, ttl time.Duration) (int64, error) {
-	path := filepath.Join(fs.rootDir, key)
+	return fs.lock(key, false, "", false, ttl)
+}
 
-	// acquire lock
-	err := os.Mkdir(path, os.ModePerm)
-	if err != nil {
-		return 0, ErrLockTaken
+func (fs *FsLocker) LockShared(key string, ttl time.Duration) (int64, error) {
+	return fs.lock(key, true, "", false, ttl)
+}
+
+func (fs *FsLocker) LockOwned(key string, owner string, ttl time.Duration) (int64, error) {
+	return fs.lock(key, false, owner, true, ttl)
+}
+
+func (fs *FsLocker) LockAnnotated(key string, annotation string, ttl time.Duration) (int64, error) {
+	return fs.lock(key, false, annotation, false, ttl)
+}
+
+func (fs *FsLocker) lock(key string, shared bool, owner string, reentrant bool, ttl time.Duration) (int64, error) {
+	// the metadata file of a lock would clash with a nested lock of the same name
+	for _, part := range strings.Split(key, KeyDelimiter)[1:] {
+		if part == metadataFilename || part == metadataFilename+".tmp" {
+			return 0, ErrNotSupported
+		}
 	}
 
-	// prepare metadata info string
-	metadata, err := NewMetadata(ttl).Encode()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return takeLock(fs, key, shared, owner, reentrant, ttl, time.Now(), fs.nextGeneration)
+}
+
+func (fs *FsLocker) Refresh(key string, generation int64) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, err := fs.getRecord(key)
 	if err != nil {
-		// couldn't encode metadata - remove lock
-		os.RemoveAll(path)
-		return 0, ErrEncodeMetadata
+		return 0, err
 	}
 
-	// write metadata info string to file
-	err = os.WriteFile(filepath.Join(path, metadataFilename), metadata, os.ModePerm)
+	gen, err := record.refresh(generation, time.Now(), fs.nextGeneration)
 	if err != nil {
-		// couldn't write metadata file - remove lock
-		os.RemoveAll(path)
-		return 0, ErrWriteMetadata
+		return 0, err
 	}
 
-	// get lock dir stats for generation number
-	dir, err := os.Stat(path)
+	err = fs.writeRecord(filepath.Join(fs.rootDir, key), record)
 	if err != nil {
-		// couldn't get lock dir stats - remove lock
-		os.RemoveAll(path)
-		return 0, ErrReadLock
+		return 0, err
 	}
 
-	return fs.getGenerationNumber(dir), nil
+	return gen, nil
 }
 
-func (fs *FsLocker) Refresh(key string, generation int64) (int64, error) {
-	path := filepath.Join(fs.rootDir, key)
+func (fs *FsLocker) Release(key string, generation int64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-	// get lock dir stats for generation number comparison
-	dir, err := os.Stat(path)
+	record, err := fs.getRecord(key)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return 0, ErrLockNotExist
-		} else {
-			return 0, ErrReadLock
-		}
+		return err
 	}
 
-	if generation != fs.getGenerationNumber(dir) {
-		return 0, ErrGenNumberMismatch
+	released, err := record.release(generation, time.Now())
+	if err != nil {
+		return err
 	}
 
-	// read current metadata and update it
-	metadataPath := filepath.Join(path, metadataFilename)
-	mdinfo, err := os.ReadFile(metadataPath)
-	if err != nil {
-		return 0, ErrReadMetadata
+	if !released {
+		return fs.writeRecord(filepath.Join(fs.rootDir, key), record)
 	}
 
-	metadata, err := ParseMetadata(mdinfo)
+	return fs.removeRecord(key)
+}
+
+func (fs *FsLocker) Swap(key string, generation int64, owner string, ttl time.Duration) (int64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, err := fs.getRecord(key)
 	if err != nil {
-		return 0, ErrDecodeMetadata
+		return 0, err
 	}
 
-	newMetadata, err := NewMetadata(time.Duration(metadata.TTL) * time.Second).Encode()
+	gen, err := record.swap(generation, owner, ttl, time.Now(), fs.nextGeneration)
 	if err != nil {
-		return 0, ErrEncodeMetadata
+		return 0, err
 	}
 
-	// remove old metadata file and create a new one to force dir's Mod timestamp update
-	err = os.Remove(metadataPath)
+	err = fs.writeRecord(filepath.Join(fs.rootDir, key), record)
 	if err != nil {
-		return 0, ErrRemoveMetadata
+		return 0, err
 	}
 
-	err = os.WriteFile(metadataPath, newMetadata, os.ModePerm)
+	return gen, nil
+}
+
+func (fs *FsLocker) Expired(key string) (int64, bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, err := fs.getRecord(key)
 	if err != nil {
-		os.RemoveAll(path)
-		return 0, ErrWriteMetadata
+		return 0, false, err
 	}
 
-	dir, err = os.Stat(path)
+	gen, expired := record.expiry(time.Now())
+	return gen, expired, nil
+}
+
+func (fs *FsLocker) Get(key string) (*LockInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	record, err := fs.getRecord(key)
 	if err != nil {
-		return 0, ErrReadLock
+		return nil, err
 	}
 
-	return fs.getGenerationNumber(dir), nil
+	return record.info(key), nil
 }
 
-func (fs *FsLocker) Release(key string, generation int64) error {
-	path := filepath.Join(fs.rootDir, key)
+// List walks rootDir for lock directories, skipping the directories
+// which can not hold locks with keys starting with the prefix
+func (fs *FsLocker) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-	dir, err := os.Stat(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return ErrLockNotExist
-		} else {
+	records := make(map[string]*lockRecord)
+	var keys []string
+
+	err := filepath.WalkDir(fs.rootDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return ErrReadLock
+		}
+
+		if !d.IsDir() || p == fs.rootDir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(fs.rootDir, p)
+		if err != nil {
 			return ErrReadLock
 		}
+		key := filepath.ToSlash(rel)
+
+		if !strings.HasPrefix(key, prefix) {
+			if strings.HasPrefix(prefix, key+KeyDelimiter) {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+
+		if skipsInternalKey(prefix, key) {
+			return filepath.SkipDir
+		}
+
+		record, err := fs.readRecord(p)
+		if err != nil {
+			if errors.Is(err, ErrLockNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		records[key] = record
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []*LockInfo
+	for _, key := range pageKeys(keys, after, limit) {
+		locks = append(locks, records[key].info(key))
 	}
+	return locks, nil
+}
+
+func (fs *FsLocker) Hierarchical() bool {
+	return true
+}
+
+func (fs *FsLocker) getRecord(key string) (*lockRecord, error) {
+	return fs.readRecord(filepath.Join(fs.rootDir, key))
+}
+
+// putRecord creates the lock directory, along with the directories
+// of the keys above it, and writes the record into it
+func (fs *FsLocker) putRecord(key string, record *lockRecord) error {
+	path := filepath.Join(fs.rootDir, key)
 
-	if generation != fs.getGenerationNumber(dir) {
-		return ErrGenNumberMismatch
+	err := os.MkdirAll(path, os.ModePerm)
+	if err != nil {
+		return ErrWriteMetadata
 	}
 
-	err = os.RemoveAll(path)
+	err = fs.writeRecord(path, record)
 	if err != nil {
+		// couldn't write metadata file - remove lock
+		fs.removeEmptyDirs(path)
+		return err
+	}
+
+	return nil
+}
+
+// removeRecord removes the metadata file of the lock and the lock
+// directory unless it still holds the directories of nested locks
+func (fs *FsLocker) removeRecord(key string) error {
+	path := filepath.Join(fs.rootDir, key)
+
+	err := os.Remove(filepath.Join(path, metadataFilename))
+	if err != nil && !os.IsNotExist(err) {
 		return ErrRemoveLock
 	}
 
+	fs.removeEmptyDirs(path)
 	return nil
 }
 
-func (fs *FsLocker) Expired(key string) (int64, bool, error) {
+// removeEmptyDirs removes the directory at path and its parents
+// up to rootDir for as long as they are empty
+func (fs *FsLocker) removeEmptyDirs(path string) {
+	for path != fs.rootDir && strings.HasPrefix(path, fs.rootDir) {
+		if os.Remove(path) != nil {
+			return
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+func (fs *FsLocker) descendantRecords(key string, fn func(key string, record *lockRecord)) error {
 	path := filepath.Join(fs.rootDir, key)
 
+	return filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return ErrReadLock
+		}
+
+		if !d.IsDir() || p == path {
+			return nil
+		}
+
+		record, err := fs.readRecord(p)
+		if err != nil {
+			if errors.Is(err, ErrLockNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(fs.rootDir, p)
+		if err != nil {
+			return ErrReadLock
+		}
+
+		fn(filepath.ToSlash(rel), record)
+		return nil
+	})
+}
+
+// readRecord reads the metadata file of the lock directory at path,
+// a directory without one only holds the directories of nested locks
+func (fs *FsLocker) readRecord(path string) (*lockRecord, error) {
 	dir, err := os.Stat(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return 0, false, ErrLockNotExist
+		// a path going through the metadata file of a lock is no lock either
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			return nil, ErrLockNotExist
 		} else {
-			return 0, false, ErrReadLock
+			return nil, ErrReadLock
+		}
+	}
+
+	// the metadata file of a lock is no lock
+	if !dir.IsDir() {
+		return nil, ErrLockNotExist
+	}
+
+	mdinfo, err := os.ReadFile(filepath.Join(path, metadataFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrLockNotExist
 		}
+		return nil, ErrReadMetadata
+	}
+
+	record, err := parseLockRecord(mdinfo)
+	if err != nil {
+		return nil, ErrDecodeMetadata
 	}
 
-	gen := fs.getGenerationNumber(dir)
+	// locks acquired before generation counter was
+	// introduced use directory mtime as generation
+	if record.Generation == 0 && !record.isShared() {
+		record.Generation = fs.getGenerationNumber(dir)
+	}
+
+	return record, nil
+}
 
-	metadataPath := filepath.Join(path, metadataFilename)
-	mdinfo, err := os.ReadFile(metadataPath)
+// writeRecord atomically replaces the metadata file of the lock directory at path
+func (fs *FsLocker) writeRecord(path string, record *lockRecord) error {
+	metadata, err := record.Encode()
 	if err != nil {
-		return 0, false, ErrReadMetadata
+		return ErrEncodeMetadata
 	}
 
-	metadata, err := ParseMetadata(mdinfo)
+	err = writeFileAtomic(filepath.Join(path, metadataFilename), metadata)
 	if err != nil {
-		return 0, false, ErrDecodeMetadata
+		return ErrWriteMetadata
 	}
 
-	expired := metadata.Expires != -1 && metadata.Expires <= time.Now().Unix()
+	return nil
+}
 
-	return gen, expired, nil
+// nextGeneration increments and persists the generation counter,
+// it must be called with the mutex held
+func (fs *FsLocker) nextGeneration() (int64, error) {
+	gen := fs.generation + 1
+
+	err := writeFileAtomic(filepath.Join(fs.rootDir, generationFilename), []byte(strconv.FormatInt(gen, 10)))
+	if err != nil {
+		return 0, ErrWriteMetadata
+	}
+
+	fs.generation = gen
+	return gen, nil
 }
 
 func (fs *FsLocker) getGenerationNumber(file fs.FileInfo) int64 {
 	return file.ModTime().UnixNano()
 }
 
+// writeFileAtomic writes data to a temporary file and renames it over
+// path, so readers never observe a partially written file. The directory
+// is synced as well, so that the rename is not lost on a crash
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
 type Metadata struct {
-	TTL     int64 `json:"ttl"`
-	Expires int64 `json:"expires"`
+	TTL      int64 `json:"ttl"`
+	Expires  int64 `json:"expires"`
+	Acquired int64 `json:"acquired,omitempty"`
 }
 
 func ParseMetadata(data []byte) (*Metadata, error) {
@@ -188,6 +461,11 @@ func ParseMetadata(data []byte) (*Metadata, error) {
 }
 
 func NewMetadata(ttl time.Duration) *Metadata {
+	return newMetadataAt(ttl, time.Now())
+}
+
+// newMetadataAt returns the metadata of a lock taken at the given time
+func newMetadataAt(ttl time.Duration, now time.Time) *Metadata {
 	var expires int64
 
 	if ttl < -1 {
@@ -197,15 +475,24 @@ func NewMetadata(ttl time.Duration) *Metadata {
 	if ttl < 0 {
 		expires = -1
 	} else {
-		expires = time.Now().Add(ttl).Unix()
+		expires = now.Add(ttl).Unix()
 	}
 
 	return &Metadata{
-		TTL:     int64(ttl.Seconds()),
-		Expires: expires,
+		TTL:      int64(ttl.Seconds()),
+		Expires:  expires,
+		Acquired: now.Unix(),
 	}
 }
 
 func (md *Metadata) Encode() ([]byte, error) {
 	return json.Marshal(md)
 }
+
+func (md *Metadata) Expired() bool {
+	return md.expiredAt(time.Now())
+}
+
+func (md *Metadata) expiredAt(now time.Time) bool {
+	return md.Expires != -1 && md.Expires <= now.Unix()
+}
@@ -13,9 +13,10 @@ const rootLockDir = "/tmp/test/locker"
 func execFsTest(t *testing.T, fn func(l *FsLocker)) {
 	locker, err := NewFsLocker(rootLockDir)
 	if err != nil {
-		t.Errorf("unexpected error: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
 	defer os.RemoveAll(rootLockDir)
+	defer locker.Close()
 
 	fn(locker)
 }
@@ -269,3 +270,350 @@ func TestRecognizesNeverExpiringLock(t *testing.T) {
 		}
 	})
 }
+
+func TestGenerationNumberIncreasesAcrossRestarts(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		gn, err := l.Lock("test.key", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+
+		l.Close()
+
+		restarted, err := NewFsLocker(rootLockDir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer restarted.Close()
+
+		gn2, err := restarted.Lock("test.key2", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("fs locker lock returned non-increasing generation number: %d", gn2)
+		}
+
+		err = restarted.Release("test.key", gn)
+		if err != nil {
+			t.Errorf("fs locker release unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRefusesDirectoryInUse(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		_, err := NewFsLocker(rootLockDir)
+		if !errors.Is(err, ErrLockerInUse) {
+			t.Errorf("expected error %v, received %v", ErrLockerInUse, err)
+		}
+	})
+}
+
+func TestHandlesLockWithoutGenerationInMetadata(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		key := "test.key"
+		path := filepath.Join(rootLockDir, key)
+
+		err := os.Mkdir(path, os.ModePerm)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		err = os.WriteFile(filepath.Join(path, metadataFilename), []byte(`{"ttl":100,"expires":-1}`), os.ModePerm)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		dir, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		gn, _, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("fs locker expired unexpected error: %v", err)
+		}
+
+		if gn != dir.ModTime().UnixNano() {
+			t.Errorf("fs locker expected mtime generation number, received %d", gn)
+		}
+
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("fs locker release unexpected error: %v", err)
+		}
+	})
+}
+
+func TestSharedLocksCoexist(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		key := "test.key"
+
+		gn, err := l.LockShared(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock shared unexpected error: %v", err)
+		}
+
+		gn2, err := l.LockShared(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock shared unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("fs locker expected lock taken error")
+		}
+
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("fs locker release unexpected error: %v", err)
+		}
+
+		_, err = os.Stat(filepath.Join(rootLockDir, key))
+		if err != nil {
+			t.Errorf("fs locker expected lock dir to be kept while shared holders remain: %v", err)
+		}
+
+		err = l.Release(key, gn2)
+		if err != nil {
+			t.Errorf("fs locker release unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+	})
+}
+
+func TestHierarchicalLocksConflict(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		gn, err := l.Lock("tenant1/db", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+
+		for _, key := range []string{"tenant1", "tenant1/db/users"} {
+			_, err = l.Lock(key, 100*time.Second)
+			if !errors.Is(err, ErrLockTaken) {
+				t.Errorf("fs locker expected lock taken error for %s", key)
+			}
+		}
+
+		_, err = l.Lock("tenant1/cache", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release("tenant1/db", gn)
+		if err != nil {
+			t.Errorf("fs locker release unexpected error: %v", err)
+		}
+
+		_, err = os.Stat(filepath.Join(rootLockDir, "tenant1", "db"))
+		if !os.IsNotExist(err) {
+			t.Errorf("fs locker expected lock dir to be removed")
+		}
+
+		_, err = l.Lock("tenant1/db/users", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+	})
+}
+
+func TestReleaseKeepsNestedLocks(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		gn, err := l.LockShared("tenant1", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock shared unexpected error: %v", err)
+		}
+
+		_, err = l.LockShared("tenant1/db", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock shared unexpected error: %v", err)
+		}
+
+		err = l.Release("tenant1", gn)
+		if err != nil {
+			t.Errorf("fs locker release unexpected error: %v", err)
+		}
+
+		_, _, err = l.Expired("tenant1/db")
+		if err != nil {
+			t.Errorf("fs locker expected nested lock to be kept: %v", err)
+		}
+
+		_, err = l.Lock("tenant1", 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("fs locker expected lock taken error")
+		}
+	})
+}
+
+func TestOwnerReentersLock(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		key := "test.key"
+
+		gn, err := l.LockOwned(key, "job-1", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock owned unexpected error: %v", err)
+		}
+
+		gn2, err := l.LockOwned(key, "job-1", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock owned unexpected error: %v", err)
+		}
+
+		if gn2 != gn {
+			t.Errorf("fs locker expected the same generation number, received %d and %d", gn, gn2)
+		}
+
+		for i := 0; i < 2; i++ {
+			_, _, err = l.Expired(key)
+			if err != nil {
+				t.Errorf("fs locker expected lock to be held: %v", err)
+			}
+
+			err = l.Release(key, gn)
+			if err != nil {
+				t.Errorf("fs locker release unexpected error: %v", err)
+			}
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+	})
+}
+
+func TestMetadataFileIsNoLock(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		gn, err := l.Lock("a", 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+
+		for _, key := range []string{"a/metadata", "a/metadata/b"} {
+			_, err = l.Get(key)
+			if !errors.Is(err, ErrLockNotExist) {
+				t.Errorf("fs locker expected lock not exist error for %s, received %v", key, err)
+			}
+
+			err = l.Release(key, gn)
+			if !errors.Is(err, ErrLockNotExist) {
+				t.Errorf("fs locker expected lock not exist error for %s, received %v", key, err)
+			}
+		}
+	})
+}
+
+func TestGetDescribesLock(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("fs locker lock unexpected error: %v", err)
+		}
+
+		info, err := l.Get(key)
+		if err != nil {
+			t.Fatalf("fs locker get unexpected error: %v", err)
+		}
+
+		if len(info.Holders) != 1 || info.Holders[0].Generation != gn || info.Holders[0].TTL != 100 {
+			t.Errorf("fs locker unexpected lock description: %+v", info)
+		}
+	})
+}
+
+func TestListPagesThroughLocks(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		for _, key := range []string{"db.users", "db.orders", "cache.sessions", "db.accounts"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("fs locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("db.", "", 2)
+		if err != nil {
+			t.Errorf("fs locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "db.accounts" || locks[1].Key != "db.orders" {
+			t.Fatalf("fs locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("db.", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("fs locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "db.users" || len(locks[0].Holders) != 1 {
+			t.Errorf("fs locker unexpected second page: %+v", locks)
+		}
+	})
+}
+
+func TestListFindsNestedLocks(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		for _, key := range []string{"tenant1/db", "tenant1/db/users", "tenant10", "tenant2/db"} {
+			_, err := l.LockShared(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("fs locker lock shared unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("tenant1/", "", 10)
+		if err != nil {
+			t.Errorf("fs locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "tenant1/db" || locks[1].Key != "tenant1/db/users" {
+			t.Errorf("fs locker unexpected locks: %+v", locks)
+		}
+	})
+}
+
+func TestListSkipsInternalLocks(t *testing.T) {
+	execFsTest(t, func(l *FsLocker) {
+		for _, key := range []string{"a", "@semaphore.db@1.0", "0", "@lfs.repo@1", "Z"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("fs locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("", "", 2)
+		if err != nil {
+			t.Errorf("fs locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "0" || locks[1].Key != "Z" {
+			t.Fatalf("fs locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("fs locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "a" {
+			t.Errorf("fs locker unexpected second page: %+v", locks)
+		}
+
+		locks, err = l.List(InternalKeyPrefix, "", 10)
+		if err != nil {
+			t.Errorf("fs locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "@lfs.repo@1" || locks[1].Key != "@semaphore.db@1.0" {
+			t.Errorf("fs locker unexpected internal locks: %+v", locks)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package locker
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockDir takes an exclusive flock of the file at path, creating it if
+// needed, and fails with ErrLockerInUse if another process holds it.
+// The lock is held until the returned file is closed
+func lockDir(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLockerInUse
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// syncDir flushes the entries of the directory at path to disk
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	if e := d.Close(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package locker
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is returned when opening a file another process has open without sharing it
+const errorSharingViolation = syscall.Errno(32)
+
+// lockDir opens the file at path, creating it if needed, without sharing
+// it and fails with ErrLockerInUse if another process has it open.
+// The file is held until the returned file is closed
+func lockDir(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if errors.Is(err, errorSharingViolation) {
+			return nil, ErrLockerInUse
+		}
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// syncDir does nothing, directories can not be synced on Windows
+func syncDir(path string) error {
+	return nil
+}
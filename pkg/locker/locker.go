@@ -20,7 +20,118 @@ type Locker interface {
 	// Check if lock is expired and returns generation number that
 	// should be used for lock release if it is expired
 	Expired(key string) (int64, bool, error)
+
+	// Get accepts a lock key and returns the description of the
+	// lock or ErrLockNotExist if it is not held
+	Get(key string) (*LockInfo, error)
+
+	// List accepts a key prefix, the key to list the locks after and
+	// the maximum number of locks to return and returns the locks with
+	// keys starting with the prefix sorted by key. Internal locks are
+	// listed only if the prefix is internal too
+	List(prefix string, after string, limit int) ([]*LockInfo, error)
+}
+
+// LockInfo describes a lock and its holders, an exclusive
+// lock has a single holder
+type LockInfo struct {
+	Key     string
+	Shared  bool
+	Holders []Holder
+}
+
+// Holder describes a single holder of a lock, Owner is set only for
+// locks taken by an owner or with an annotation and Holds counts how
+// many times the owner took the lock, it is not set for annotations
+type Holder struct {
+	Generation int64
+	Metadata
+	Owner string
+	Holds int
+}
+
+// SharedLocker is implemented by lockers which besides exclusive
+// locks support shared locks, held by many holders at once. Every
+// shared holder gets its own generation number to refresh and
+// release its hold with
+type SharedLocker interface {
+	Locker
+
+	// LockShared accepts a lock key as well as the TTL for the
+	// hold and returns the generation number if the lock is not
+	// held exclusively or an error otherwise
+	LockShared(key string, ttl time.Duration) (int64, error)
+}
+
+// HierarchicalLocker is implemented by lockers which treat keys split
+// by KeyDelimiter as a tree, where a lock conflicts with the locks held
+// on the keys above and below it unless both are held in shared mode
+type HierarchicalLocker interface {
+	Locker
+
+	// Hierarchical reports whether hierarchical keys are supported
+	Hierarchical() bool
+}
+
+// ReentrantLocker is implemented by lockers which let the owner of an
+// exclusive lock take it again. Every time the owner takes the lock it
+// gets the same generation number and the lock is held until it has
+// been released as many times as it was taken or until it expires.
+// Refreshing a lock taken by an owner keeps its generation number
+type ReentrantLocker interface {
+	Locker
+
+	// LockOwned accepts a lock key, the owner taking the lock as well
+	// as the TTL for the lock and returns the generation number if the
+	// lock was acquired or is already held by the owner or an error
+	// otherwise
+	LockOwned(key string, owner string, ttl time.Duration) (int64, error)
+}
+
+// AnnotatedLocker is implemented by lockers which can keep an annotation
+// with an exclusive lock. The annotation is kept as the owner of the
+// lock, but unlike an owner it never takes the lock again and the lock
+// is not taken again by an owner equal to it
+type AnnotatedLocker interface {
+	Locker
+
+	// LockAnnotated accepts a lock key, the annotation of the lock as
+	// well as the TTL for the lock and returns the generation number
+	// if the lock was acquired or an error otherwise
+	LockAnnotated(key string, annotation string, ttl time.Duration) (int64, error)
+}
+
+// SwappingLocker is implemented by lockers which can hand an exclusive
+// lock over to another owner at once, without the lock being released
+// in between for anyone else to take it. A lock taken with an annotation
+// is handed over to another annotation
+type SwappingLocker interface {
+	Locker
+
+	// Swap accepts a lock key, the generation number of its holder,
+	// the owner to hand the lock over to as well as the TTL for the
+	// lock and returns the new generation number if the lock is still
+	// held exclusively by the holder or an error otherwise
+	Swap(key string, generation int64, owner string, ttl time.Duration) (int64, error)
 }
 
 // compile time check to ensure interface implementation
-var _ Locker = &FsLocker{}
+var _ SharedLocker = &FsLocker{}
+var _ SharedLocker = &MemLocker{}
+var _ SharedLocker = &BoltLocker{}
+var _ HierarchicalLocker = &FsLocker{}
+var _ HierarchicalLocker = &MemLocker{}
+var _ HierarchicalLocker = &BoltLocker{}
+var _ ReentrantLocker = &FsLocker{}
+var _ ReentrantLocker = &MemLocker{}
+var _ ReentrantLocker = &BoltLocker{}
+var _ AnnotatedLocker = &FsLocker{}
+var _ AnnotatedLocker = &MemLocker{}
+var _ AnnotatedLocker = &BoltLocker{}
+var _ SwappingLocker = &FsLocker{}
+var _ SwappingLocker = &MemLocker{}
+var _ SwappingLocker = &BoltLocker{}
+var _ Locker = &RedisLocker{}
+var _ Locker = &PostgresLocker{}
+var _ Locker = &EtcdLocker{}
+var _ Locker = &SQLiteLocker{}
@@ -0,0 +1,93 @@
+package locker
+
+import (
+	"sync"
+	"time"
+)
+
+type MemLocker struct {
+	mu         sync.Mutex
+	locks      *Table
+	generation int64
+}
+
+func NewMemLocker() *MemLocker {
+	return &MemLocker{
+		locks: NewTable(),
+	}
+}
+
+func (m *MemLocker) Lock(key string, ttl time.Duration) (int64, error) {
+	return m.lock(key, false, "", false, ttl)
+}
+
+func (m *MemLocker) LockShared(key string, ttl time.Duration) (int64, error) {
+	return m.lock(key, true, "", false, ttl)
+}
+
+func (m *MemLocker) LockOwned(key string, owner string, ttl time.Duration) (int64, error) {
+	return m.lock(key, false, owner, true, ttl)
+}
+
+func (m *MemLocker) LockAnnotated(key string, annotation string, ttl time.Duration) (int64, error) {
+	return m.lock(key, false, annotation, false, ttl)
+}
+
+func (m *MemLocker) lock(key string, shared bool, owner string, reentrant bool, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locks.Lock(key, shared, owner, reentrant, ttl, time.Now(), m.nextGeneration)
+}
+
+func (m *MemLocker) Refresh(key string, generation int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locks.Refresh(key, generation, time.Now(), m.nextGeneration)
+}
+
+func (m *MemLocker) Release(key string, generation int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locks.Release(key, generation, time.Now())
+}
+
+func (m *MemLocker) Swap(key string, generation int64, owner string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locks.Swap(key, generation, owner, ttl, time.Now(), m.nextGeneration)
+}
+
+func (m *MemLocker) Expired(key string) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locks.Expired(key, time.Now())
+}
+
+func (m *MemLocker) Get(key string) (*LockInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locks.Get(key)
+}
+
+func (m *MemLocker) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.locks.List(prefix, after, limit)
+}
+
+func (m *MemLocker) Hierarchical() bool {
+	return true
+}
+
+// nextGeneration must be called with the mutex held
+func (m *MemLocker) nextGeneration() (int64, error) {
+	m.generation++
+	return m.generation, nil
+}
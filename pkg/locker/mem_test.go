@@ -0,0 +1,581 @@
+package locker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemLockPreventsConsecutiveLock(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	_, err := l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	_, err = l.Lock(key, 100*time.Second)
+	if !errors.Is(err, ErrLockTaken) {
+		t.Errorf("mem locker expected lock taken error")
+	}
+}
+
+func TestMemReleaseAllowsConsecutiveLocks(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	err = l.Release(key, gn)
+	if err != nil {
+		t.Errorf("mem locker release unexpected error: %v", err)
+	}
+
+	_, err = l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+}
+
+func TestMemReleaseFailsOnGenerationNumberMismatch(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	err = l.Release(key, gn+10)
+	if !errors.Is(err, ErrGenNumberMismatch) {
+		t.Errorf("mem locker expected generation number mismatch error")
+	}
+}
+
+func TestMemRefreshReturnsValidNewGenerationNumber(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	gn2, err := l.Refresh(key, gn)
+	if err != nil {
+		t.Errorf("mem locker refresh unexpected error: %v", err)
+	}
+
+	if gn2 <= gn {
+		t.Errorf("mem locker refresh returned non-increasing generation number: %d", gn2)
+	}
+
+	err = l.Release(key, gn2)
+	if err != nil {
+		t.Errorf("mem locker release unexpected error: %v", err)
+	}
+}
+
+func TestMemRefreshFailsOnNonExistingLock(t *testing.T) {
+	l := NewMemLocker()
+
+	_, err := l.Refresh("test.key", 1)
+	if !errors.Is(err, ErrLockNotExist) {
+		t.Errorf("mem locker expected lock not exist error")
+	}
+}
+
+func TestMemRecognizesExpiredLock(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	_, err := l.Lock(key, 0)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	_, exp, err := l.Expired(key)
+	if err != nil {
+		t.Errorf("mem locker expired unexpected error: %v", err)
+	}
+
+	if !exp {
+		t.Errorf("expected lock to be expired")
+	}
+}
+
+func TestMemRecognizesNeverExpiringLock(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	_, err := l.Lock(key, -1*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	_, exp, err := l.Expired(key)
+	if err != nil {
+		t.Errorf("mem locker expired unexpected error: %v", err)
+	}
+
+	if exp {
+		t.Errorf("expected lock to be non-expired")
+	}
+}
+
+func TestMemSharedLocksCoexist(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.LockShared(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock shared unexpected error: %v", err)
+	}
+
+	gn2, err := l.LockShared(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock shared unexpected error: %v", err)
+	}
+
+	if gn == gn2 {
+		t.Errorf("mem locker shared holders got the same generation number: %d", gn)
+	}
+
+	_, err = l.Lock(key, 100*time.Second)
+	if !errors.Is(err, ErrLockTaken) {
+		t.Errorf("mem locker expected lock taken error")
+	}
+
+	gn3, err := l.Refresh(key, gn)
+	if err != nil {
+		t.Errorf("mem locker refresh unexpected error: %v", err)
+	}
+
+	for _, g := range []int64{gn2, gn3} {
+		err = l.Release(key, g)
+		if err != nil {
+			t.Errorf("mem locker release unexpected error: %v", err)
+		}
+	}
+
+	_, err = l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	_, err = l.LockShared(key, 100*time.Second)
+	if !errors.Is(err, ErrLockTaken) {
+		t.Errorf("mem locker expected lock taken error")
+	}
+}
+
+func TestMemExclusiveLockTakesOverExpiredSharedLocks(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	for i := 0; i < 2; i++ {
+		_, err := l.LockShared(key, 0)
+		if err != nil {
+			t.Errorf("mem locker lock shared unexpected error: %v", err)
+		}
+	}
+
+	_, err := l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+}
+
+func TestMemHierarchicalLocksConflict(t *testing.T) {
+	l := NewMemLocker()
+
+	gn, err := l.Lock("tenant1/db", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"tenant1", "tenant1/db/users"} {
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("mem locker expected lock taken error for %s", key)
+		}
+	}
+
+	for _, key := range []string{"tenant1/cache", "tenant2", "tenant1.db"} {
+		_, err = l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("mem locker lock %s unexpected error: %v", key, err)
+		}
+	}
+
+	err = l.Release("tenant1/db", gn)
+	if err != nil {
+		t.Errorf("mem locker release unexpected error: %v", err)
+	}
+
+	_, err = l.Lock("tenant1/db/users", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+}
+
+func TestMemHierarchicalSharedLocksCoexist(t *testing.T) {
+	l := NewMemLocker()
+
+	_, err := l.LockShared("tenant1", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock shared unexpected error: %v", err)
+	}
+
+	_, err = l.LockShared("tenant1/db", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock shared unexpected error: %v", err)
+	}
+
+	_, err = l.Lock("tenant1/cache", 100*time.Second)
+	if !errors.Is(err, ErrLockTaken) {
+		t.Errorf("mem locker expected lock taken error")
+	}
+}
+
+func TestMemHierarchicalLockTakesOverExpiredDescendant(t *testing.T) {
+	l := NewMemLocker()
+
+	gn, err := l.Lock("tenant1/db", 0)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	_, err = l.Lock("tenant1", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+
+	_, err = l.Refresh("tenant1/db", gn)
+	if !errors.Is(err, ErrLockNotExist) {
+		t.Errorf("mem locker expected lock not exist error")
+	}
+}
+
+func TestMemOwnerReentersLock(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.LockOwned(key, "job-1", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+
+	gn2, err := l.LockOwned(key, "job-1", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+
+	if gn2 != gn {
+		t.Errorf("mem locker expected the same generation number, received %d and %d", gn, gn2)
+	}
+
+	for _, owner := range []string{"job-2", ""} {
+		_, err = l.LockOwned(key, owner, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("mem locker expected lock taken error for owner %q", owner)
+		}
+	}
+
+	err = l.Release(key, gn)
+	if err != nil {
+		t.Errorf("mem locker release unexpected error: %v", err)
+	}
+
+	_, err = l.LockOwned(key, "job-2", 100*time.Second)
+	if !errors.Is(err, ErrLockTaken) {
+		t.Errorf("mem locker expected lock to be held until released twice")
+	}
+
+	err = l.Release(key, gn)
+	if err != nil {
+		t.Errorf("mem locker release unexpected error: %v", err)
+	}
+
+	_, err = l.LockOwned(key, "job-2", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+}
+
+func TestMemAnnotatedLockIsNotReentered(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.LockAnnotated(key, `{"id":1}`, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock annotated unexpected error: %v", err)
+	}
+
+	for _, lock := range []func() (int64, error){
+		func() (int64, error) { return l.LockAnnotated(key, `{"id":1}`, 100*time.Second) },
+		func() (int64, error) { return l.LockOwned(key, `{"id":1}`, 100*time.Second) },
+	} {
+		_, err = lock()
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("mem locker expected lock taken error, received %v", err)
+		}
+	}
+
+	info, err := l.Get(key)
+	if err != nil {
+		t.Errorf("mem locker get unexpected error: %v", err)
+	} else if info.Holders[0].Owner != `{"id":1}` || info.Holders[0].Holds != 0 {
+		t.Errorf("mem locker unexpected holder %+v", info.Holders[0])
+	}
+
+	err = l.Release(key, gn)
+	if err != nil {
+		t.Errorf("mem locker release unexpected error: %v", err)
+	}
+
+	_, err = l.Lock(key, 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock unexpected error: %v", err)
+	}
+}
+
+func TestMemRefreshKeepsReenteredLockGeneration(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.LockOwned(key, "o", -1*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+
+	_, err = l.LockOwned(key, "o", -1*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+
+	gn2, err := l.Refresh(key, gn)
+	if err != nil {
+		t.Errorf("mem locker refresh unexpected error: %v", err)
+	}
+
+	if gn2 != gn {
+		t.Errorf("mem locker expected the same generation number, received %d and %d", gn, gn2)
+	}
+
+	// the inner and the outer holds are released with the generation number they were taken with
+	for i := 0; i < 2; i++ {
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("mem locker release unexpected error: %v", err)
+		}
+	}
+
+	_, err = l.Get(key)
+	if !errors.Is(err, ErrLockNotExist) {
+		t.Errorf("mem locker expected lock to be released, received %v", err)
+	}
+}
+
+func TestMemSwapHandsLockOver(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.LockOwned(key, "o1", -1*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+
+	gn2, err := l.Swap(key, gn, "o2", -1*time.Second)
+	if err != nil {
+		t.Errorf("mem locker swap unexpected error: %v", err)
+	}
+
+	if gn2 == gn {
+		t.Errorf("mem locker expected a new generation number, received %d", gn2)
+	}
+
+	info, err := l.Get(key)
+	if err != nil || info.Holders[0].Owner != "o2" || info.Holders[0].Generation != gn2 {
+		t.Errorf("mem locker expected lock to be held by the new owner, received %+v, %v", info, err)
+	}
+
+	_, err = l.Swap(key, gn, "o3", -1*time.Second)
+	if !errors.Is(err, ErrGenNumberMismatch) {
+		t.Errorf("mem locker expected error %v, received %v", ErrGenNumberMismatch, err)
+	}
+
+	_, err = l.Swap("other.key", gn2, "o3", -1*time.Second)
+	if !errors.Is(err, ErrLockNotExist) {
+		t.Errorf("mem locker expected error %v, received %v", ErrLockNotExist, err)
+	}
+}
+
+func TestMemSwapKeepsAnnotatedLockNotReentrant(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	gn, err := l.LockAnnotated(key, "a1", -1*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock annotated unexpected error: %v", err)
+	}
+
+	_, err = l.Swap(key, gn, "a2", -1*time.Second)
+	if err != nil {
+		t.Errorf("mem locker swap unexpected error: %v", err)
+	}
+
+	_, err = l.LockOwned(key, "a2", -1*time.Second)
+	if !errors.Is(err, ErrLockTaken) {
+		t.Errorf("mem locker expected lock taken error, received %v", err)
+	}
+}
+
+func TestMemReleasesExpiredReenteredLock(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	_, err := l.LockOwned(key, "job-1", 0)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+
+	_, err = l.LockOwned(key, "job-1", 0)
+	if !errors.Is(err, ErrLockTaken) {
+		t.Errorf("mem locker expected expired lock not to be reentered")
+	}
+
+	gn, expired, err := l.Expired(key)
+	if err != nil || !expired {
+		t.Errorf("mem locker expected expired lock: %v", err)
+	}
+
+	err = l.Release(key, gn)
+	if err != nil {
+		t.Errorf("mem locker release unexpected error: %v", err)
+	}
+
+	_, _, err = l.Expired(key)
+	if !errors.Is(err, ErrLockNotExist) {
+		t.Errorf("mem locker expected lock not exist error")
+	}
+}
+
+func TestMemGetDescribesLock(t *testing.T) {
+	l := NewMemLocker()
+	key := "test.key"
+
+	_, err := l.Get(key)
+	if !errors.Is(err, ErrLockNotExist) {
+		t.Errorf("mem locker expected lock not exist error")
+	}
+
+	gn, err := l.LockOwned(key, "job-1", 100*time.Second)
+	if err != nil {
+		t.Errorf("mem locker lock owned unexpected error: %v", err)
+	}
+
+	gn, err = l.Refresh(key, gn)
+	if err != nil {
+		t.Errorf("mem locker refresh unexpected error: %v", err)
+	}
+
+	info, err := l.Get(key)
+	if err != nil {
+		t.Fatalf("mem locker get unexpected error: %v", err)
+	}
+
+	if info.Shared || len(info.Holders) != 1 {
+		t.Fatalf("mem locker expected a single exclusive holder, received %+v", info)
+	}
+
+	h := info.Holders[0]
+	if h.Generation != gn || h.TTL != 100 || h.Owner != "job-1" || h.Holds != 1 || h.Acquired == 0 {
+		t.Errorf("mem locker unexpected holder: %+v", h)
+	}
+
+	_, err = l.LockShared("shared.key", -1)
+	if err != nil {
+		t.Errorf("mem locker lock shared unexpected error: %v", err)
+	}
+
+	info, err = l.Get("shared.key")
+	if err != nil {
+		t.Fatalf("mem locker get unexpected error: %v", err)
+	}
+
+	if !info.Shared || len(info.Holders) != 1 || info.Holders[0].Expires != -1 {
+		t.Errorf("mem locker expected a single immortal shared holder, received %+v", info)
+	}
+}
+
+func TestMemListPagesThroughLocks(t *testing.T) {
+	l := NewMemLocker()
+
+	for _, key := range []string{"db.users", "db.orders", "cache.sessions", "db.accounts"} {
+		_, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("mem locker lock unexpected error: %v", err)
+		}
+	}
+
+	locks, err := l.List("db.", "", 2)
+	if err != nil {
+		t.Errorf("mem locker list unexpected error: %v", err)
+	}
+
+	if len(locks) != 2 || locks[0].Key != "db.accounts" || locks[1].Key != "db.orders" {
+		t.Fatalf("mem locker unexpected first page: %+v", locks)
+	}
+
+	locks, err = l.List("db.", locks[1].Key, 2)
+	if err != nil {
+		t.Errorf("mem locker list unexpected error: %v", err)
+	}
+
+	if len(locks) != 1 || locks[0].Key != "db.users" || len(locks[0].Holders) != 1 {
+		t.Errorf("mem locker unexpected second page: %+v", locks)
+	}
+}
+
+func TestMemListSkipsInternalLocks(t *testing.T) {
+	l := NewMemLocker()
+
+	for _, key := range []string{"a", "@semaphore.db@1.0", "0", "@lfs.repo@1", "Z"} {
+		_, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("mem locker lock unexpected error: %v", err)
+		}
+	}
+
+	locks, err := l.List("", "", 2)
+	if err != nil {
+		t.Errorf("mem locker list unexpected error: %v", err)
+	}
+
+	if len(locks) != 2 || locks[0].Key != "0" || locks[1].Key != "Z" {
+		t.Fatalf("mem locker unexpected first page: %+v", locks)
+	}
+
+	locks, err = l.List("", locks[1].Key, 2)
+	if err != nil {
+		t.Errorf("mem locker list unexpected error: %v", err)
+	}
+
+	if len(locks) != 1 || locks[0].Key != "a" {
+		t.Errorf("mem locker unexpected second page: %+v", locks)
+	}
+
+	locks, err = l.List(InternalKeyPrefix, "", 10)
+	if err != nil {
+		t.Errorf("mem locker list unexpected error: %v", err)
+	}
+
+	if len(locks) != 2 || locks[0].Key != "@lfs.repo@1" || locks[1].Key != "@semaphore.db@1.0" {
+		t.Errorf("mem locker unexpected internal locks: %+v", locks)
+	}
+}
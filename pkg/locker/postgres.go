@@ -0,0 +1,192 @@
+package locker
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresMigrations are applied in order on startup
+var postgresMigrations = []string{
+	`CREATE SEQUENCE lockronomicon_generation`,
+	`CREATE TABLE lockronomicon_locks (
+		key        text PRIMARY KEY,
+		generation bigint NOT NULL,
+		ttl        bigint NOT NULL,
+		expires_at timestamptz
+	)`,
+	`ALTER TABLE lockronomicon_locks ADD COLUMN acquired_at timestamptz`,
+}
+
+// postgresLockColumns are the columns read by scanLock
+const postgresLockColumns = `key, generation, ttl, extract(epoch FROM expires_at)::bigint, extract(epoch FROM acquired_at)::bigint`
+
+// PostgresLocker keeps every lock as a row in the lockronomicon_locks table
+type PostgresLocker struct {
+	db *sql.DB
+}
+
+func NewPostgresLocker(dsn string) (*PostgresLocker, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migratePostgres(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresLocker{
+		db: db,
+	}, nil
+}
+
+func migratePostgres(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// serialize migrations of concurrently starting instances
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('lockronomicon_migrations'))`)
+	if err != nil {
+		return err
+	}
+
+	err = applyMigrations(tx, postgresMigrations)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *PostgresLocker) Close() error {
+	return p.db.Close()
+}
+
+func (p *PostgresLocker) Lock(key string, ttl time.Duration) (int64, error) {
+	md := NewMetadata(ttl)
+
+	var gen int64
+	err := p.db.QueryRow(`
+		INSERT INTO lockronomicon_locks (key, generation, ttl, expires_at, acquired_at)
+		VALUES ($1, nextval('lockronomicon_generation'), $2::bigint, CASE WHEN $2::bigint < 0 THEN NULL ELSE now() + make_interval(secs => $2::bigint) END, now())
+		ON CONFLICT (key) DO NOTHING
+		RETURNING generation`,
+		key, md.TTL,
+	).Scan(&gen)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrLockTaken
+		}
+		return 0, ErrWriteMetadata
+	}
+
+	return gen, nil
+}
+
+func (p *PostgresLocker) Refresh(key string, generation int64) (int64, error) {
+	var gen int64
+	err := p.db.QueryRow(`
+		UPDATE lockronomicon_locks
+		SET generation = nextval('lockronomicon_generation'),
+			expires_at = CASE WHEN ttl < 0 THEN NULL ELSE now() + make_interval(secs => ttl) END
+		WHERE key = $1 AND generation = $2
+		RETURNING generation`,
+		key, generation,
+	).Scan(&gen)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, p.mismatchError(key)
+		}
+		return 0, ErrWriteMetadata
+	}
+
+	return gen, nil
+}
+
+func (p *PostgresLocker) Release(key string, generation int64) error {
+	res, err := p.db.Exec(`DELETE FROM lockronomicon_locks WHERE key = $1 AND generation = $2`, key, generation)
+	if err != nil {
+		return ErrRemoveLock
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return ErrRemoveLock
+	}
+
+	if n == 0 {
+		return p.mismatchError(key)
+	}
+
+	return nil
+}
+
+func (p *PostgresLocker) Expired(key string) (int64, bool, error) {
+	var gen int64
+	var expired bool
+
+	err := p.db.QueryRow(`
+		SELECT generation, COALESCE(expires_at <= now(), false)
+		FROM lockronomicon_locks
+		WHERE key = $1`,
+		key,
+	).Scan(&gen, &expired)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, ErrLockNotExist
+		}
+		return 0, false, ErrReadLock
+	}
+
+	return gen, expired, nil
+}
+
+func (p *PostgresLocker) Get(key string) (*LockInfo, error) {
+	return scanLock(p.db.QueryRow(`
+		SELECT `+postgresLockColumns+`
+		FROM lockronomicon_locks
+		WHERE key = $1`,
+		key,
+	))
+}
+
+// List compares keys bytewise, the same way as the other lockers do
+func (p *PostgresLocker) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	rows, err := p.db.Query(`
+		SELECT `+postgresLockColumns+`
+		FROM lockronomicon_locks
+		WHERE left(key, length($1)) = $1 AND key COLLATE "C" > $2
+			AND (left($1, 1) = '`+InternalKeyPrefix+`' OR left(key, 1) <> '`+InternalKeyPrefix+`')
+		ORDER BY key COLLATE "C"
+		LIMIT $3`,
+		prefix, after, limit,
+	)
+	if err != nil {
+		return nil, ErrReadLock
+	}
+
+	return scanLocks(rows)
+}
+
+// mismatchError tells apart a missing lock from a generation mismatch
+// after a conditional statement did not match any rows
+func (p *PostgresLocker) mismatchError(key string) error {
+	var exists bool
+	err := p.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM lockronomicon_locks WHERE key = $1)`, key).Scan(&exists)
+	if err != nil {
+		return ErrReadLock
+	}
+
+	if !exists {
+		return ErrLockNotExist
+	}
+
+	return ErrGenNumberMismatch
+}
@@ -0,0 +1,236 @@
+package locker
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// postgres tests run only against a database provided through
+// the LOCKRONOMICON_TEST_POSTGRES_DSN environment variable
+func execPostgresTest(t *testing.T, fn func(l *PostgresLocker)) {
+	dsn := os.Getenv("LOCKRONOMICON_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LOCKRONOMICON_TEST_POSTGRES_DSN not set")
+	}
+
+	locker, err := NewPostgresLocker(dsn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer locker.Close()
+	defer locker.db.Exec(`DELETE FROM lockronomicon_locks`)
+
+	fn(locker)
+}
+
+func TestPostgresLockPreventsConsecutiveLock(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("postgres locker expected lock taken error")
+		}
+	})
+}
+
+func TestPostgresReleaseAllowsConsecutiveLocks(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("postgres locker release unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+	})
+}
+
+func TestPostgresReleaseFailsOnGenerationNumberMismatch(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn+10)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("postgres locker expected generation number mismatch error")
+		}
+
+		err = l.Release("other.key", gn)
+		if !errors.Is(err, ErrLockNotExist) {
+			t.Errorf("postgres locker expected lock not exist error")
+		}
+	})
+}
+
+func TestPostgresRefreshReturnsValidNewGenerationNumber(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+
+		gn2, err := l.Refresh(key, gn)
+		if err != nil {
+			t.Errorf("postgres locker refresh unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("postgres locker refresh returned non-increasing generation number: %d", gn2)
+		}
+
+		_, err = l.Refresh(key, gn)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("postgres locker expected generation number mismatch error")
+		}
+	})
+}
+
+func TestPostgresRecognizesExpiredLock(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 0)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+
+		_, exp, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("postgres locker expired unexpected error: %v", err)
+		}
+
+		if !exp {
+			t.Errorf("expected lock to be expired")
+		}
+	})
+}
+
+func TestPostgresRecognizesNeverExpiringLock(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		key := "test.key"
+
+		_, err := l.Lock(key, -1*time.Second)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+
+		_, exp, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("postgres locker expired unexpected error: %v", err)
+		}
+
+		if exp {
+			t.Errorf("expected lock to be non-expired")
+		}
+	})
+}
+
+func TestPostgresGetDescribesLock(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("postgres locker lock unexpected error: %v", err)
+		}
+
+		info, err := l.Get(key)
+		if err != nil {
+			t.Fatalf("postgres locker get unexpected error: %v", err)
+		}
+
+		if len(info.Holders) != 1 || info.Holders[0].Generation != gn || info.Holders[0].TTL != 100 {
+			t.Errorf("postgres locker unexpected lock description: %+v", info)
+		}
+	})
+}
+
+func TestPostgresListPagesThroughLocks(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		for _, key := range []string{"db.users", "db.orders", "cache.sessions", "db.accounts"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("postgres locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("db.", "", 2)
+		if err != nil {
+			t.Errorf("postgres locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "db.accounts" || locks[1].Key != "db.orders" {
+			t.Fatalf("postgres locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("db.", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("postgres locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "db.users" || len(locks[0].Holders) != 1 {
+			t.Errorf("postgres locker unexpected second page: %+v", locks)
+		}
+	})
+}
+
+func TestPostgresListSkipsInternalLocks(t *testing.T) {
+	execPostgresTest(t, func(l *PostgresLocker) {
+		for _, key := range []string{"a", "@semaphore.db@1.0", "0", "@lfs.repo@1", "Z"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("postgres locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("", "", 2)
+		if err != nil {
+			t.Errorf("postgres locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "0" || locks[1].Key != "Z" {
+			t.Fatalf("postgres locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("postgres locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "a" {
+			t.Errorf("postgres locker unexpected second page: %+v", locks)
+		}
+
+		locks, err = l.List(InternalKeyPrefix, "", 10)
+		if err != nil {
+			t.Errorf("postgres locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "@lfs.repo@1" || locks[1].Key != "@semaphore.db@1.0" {
+			t.Errorf("postgres locker unexpected internal locks: %+v", locks)
+		}
+	})
+}
@@ -0,0 +1,386 @@
+package locker
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KeyDelimiter separates the levels of hierarchical lock keys, e.g. a lock
+// on "tenant1" conflicts with a lock on "tenant1/db" and the other way around
+const KeyDelimiter = "/"
+
+// InternalKeyPrefix starts the keys of the locks the server takes for its
+// other APIs, it is not allowed in lock keys so they never clash with them
+const InternalKeyPrefix = "@"
+
+// internalKeysEnd is the smallest key sorted after every internal key
+const internalKeysEnd = "A"
+
+// IsInternalKey reports whether the key is the key of an internal lock
+func IsInternalKey(key string) bool {
+	return strings.HasPrefix(key, InternalKeyPrefix)
+}
+
+// skipsInternalKey reports whether listing the locks with the prefix skips the
+// key, internal locks are only listed for the prefixes which are internal too
+func skipsInternalKey(prefix string, key string) bool {
+	return IsInternalKey(key) && !IsInternalKey(prefix)
+}
+
+// keyAncestors returns the keys above the given key, topmost first
+func keyAncestors(key string) []string {
+	var ancestors []string
+	for i := 0; i < len(key); i++ {
+		if strings.HasPrefix(key[i:], KeyDelimiter) {
+			ancestors = append(ancestors, key[:i])
+		}
+	}
+	return ancestors
+}
+
+// pageKeys sorts the keys and returns at most limit of those sorted after the given key
+func pageKeys(keys []string, after string, limit int) []string {
+	sort.Strings(keys)
+
+	i := sort.SearchStrings(keys, after)
+	if i < len(keys) && keys[i] == after {
+		i++
+	}
+	keys = keys[i:]
+
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+// isDescendant reports whether key is nested under the ancestor key
+func isDescendant(key string, ancestor string) bool {
+	return strings.HasPrefix(key, ancestor+KeyDelimiter)
+}
+
+// lockRecord is the single value stored per lock key by the FS and
+// database backed lockers. A lock held in shared mode keeps its
+// holders in Shared and has no generation of its own. An exclusive
+// lock taken by an owner counts how many times the owner took it, a
+// lock taken with an annotation keeps it as the owner and has no holds
+type lockRecord struct {
+	Generation int64 `json:"generation"`
+	Metadata
+	Owner  string       `json:"owner,omitempty"`
+	Holds  int          `json:"holds,omitempty"`
+	Shared []lockRecord `json:"shared,omitempty"`
+}
+
+func parseLockRecord(data []byte) (*lockRecord, error) {
+	var record lockRecord
+	err := json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *lockRecord) Encode() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *lockRecord) isShared() bool {
+	return r.Generation == 0 && len(r.Shared) > 0
+}
+
+// pruneShared drops shared holders expired at the given time
+func (r *lockRecord) pruneShared(now time.Time) {
+	live := r.Shared[:0]
+	for _, h := range r.Shared {
+		if !h.expiredAt(now) {
+			live = append(live, h)
+		}
+	}
+	r.Shared = live
+}
+
+// holder returns the holder of the lock with the given generation number
+func (r *lockRecord) holder(generation int64) (*lockRecord, error) {
+	if !r.isShared() {
+		if r.Generation != generation {
+			return nil, ErrGenNumberMismatch
+		}
+		return r, nil
+	}
+
+	for i := range r.Shared {
+		if r.Shared[i].Generation == generation {
+			return &r.Shared[i], nil
+		}
+	}
+
+	return nil, ErrGenNumberMismatch
+}
+
+// refresh renews the hold of the holder with the given generation
+// number and returns the holder's new generation number. A lock taken
+// by an owner keeps its generation number, as every hold of the owner
+// is released with it
+func (r *lockRecord) refresh(generation int64, now time.Time, next func() (int64, error)) (int64, error) {
+	holder, err := r.holder(generation)
+	if err != nil {
+		return 0, err
+	}
+
+	gen := holder.Generation
+	if holder.Owner == "" {
+		gen, err = next()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	acquired := holder.Acquired
+	holder.Generation = gen
+	holder.Metadata = *newMetadataAt(time.Duration(holder.TTL)*time.Second, now)
+	holder.Acquired = acquired
+
+	return gen, nil
+}
+
+// release removes the holder with the given generation number
+// and reports whether the lock is not held anymore, a lock taken
+// by its owner more than once is held until released as many times
+// or until it expires
+func (r *lockRecord) release(generation int64, now time.Time) (bool, error) {
+	if _, err := r.holder(generation); err != nil {
+		return false, err
+	}
+
+	if !r.isShared() {
+		if r.Holds > 1 && !r.expiredAt(now) {
+			r.Holds--
+			return false, nil
+		}
+		return true, nil
+	}
+
+	for i := range r.Shared {
+		if r.Shared[i].Generation == generation {
+			r.Shared = append(r.Shared[:i], r.Shared[i+1:]...)
+			break
+		}
+	}
+
+	return len(r.Shared) == 0, nil
+}
+
+// swap replaces the holder of the exclusive lock having the given
+// generation number with a new hold of the owner, taken once, and
+// returns the generation number of the new hold. The new hold of a
+// lock taken with an annotation is not reentrant either
+func (r *lockRecord) swap(generation int64, owner string, ttl time.Duration, now time.Time, next func() (int64, error)) (int64, error) {
+	if r.isShared() || r.Generation != generation {
+		return 0, ErrGenNumberMismatch
+	}
+
+	gen, err := next()
+	if err != nil {
+		return 0, err
+	}
+
+	reentrant := r.Owner == "" || r.Holds > 0
+	*r = lockRecord{
+		Generation: gen,
+		Metadata:   *newMetadataAt(ttl, now),
+		Owner:      owner,
+	}
+
+	if owner != "" && reentrant {
+		r.Holds = 1
+	}
+
+	return gen, nil
+}
+
+// expiry returns the generation number of the holder expiring last
+// and whether every holder of the lock has expired at the given time
+func (r *lockRecord) expiry(now time.Time) (int64, bool) {
+	if !r.isShared() {
+		return r.Generation, r.expiredAt(now)
+	}
+
+	last := r.Shared[0]
+	for _, h := range r.Shared[1:] {
+		if h.Expires == -1 || (last.Expires != -1 && h.Expires > last.Expires) {
+			last = h
+		}
+	}
+
+	return last.Generation, last.expiredAt(now)
+}
+
+// info describes the lock held on key with the record
+func (r *lockRecord) info(key string) *LockInfo {
+	info := &LockInfo{
+		Key:    key,
+		Shared: r.isShared(),
+	}
+
+	if !info.Shared {
+		info.Holders = []Holder{r.asHolder()}
+		return info
+	}
+
+	for _, h := range r.Shared {
+		info.Holders = append(info.Holders, h.asHolder())
+	}
+	return info
+}
+
+func (r *lockRecord) asHolder() Holder {
+	return Holder{
+		Generation: r.Generation,
+		Metadata:   r.Metadata,
+		Owner:      r.Owner,
+		Holds:      r.Holds,
+	}
+}
+
+// blocks reports whether the record, held on an ancestor or a descendant
+// of a key, keeps a lock in the given mode from being taken on that key
+func (r *lockRecord) blocks(shared bool, now time.Time) bool {
+	if shared && r.isShared() {
+		return false
+	}
+
+	_, expired := r.expiry(now)
+	return !expired
+}
+
+// acquireRecord returns the record of the lock taken in the given mode
+// and the generation number of the new holder if the current record
+// (nil if the lock is not held) allows taking it, next is called only
+// once the lock can be taken. An exclusive lock held by the owner is
+// taken again keeping its generation number if both the lock held and
+// the lock taken are reentrant
+func acquireRecord(current *lockRecord, shared bool, owner string, reentrant bool, ttl time.Duration, now time.Time, next func() (int64, error)) (*lockRecord, int64, error) {
+	if current != nil {
+		if !current.isShared() {
+			if reentrant && owner != "" && !shared && current.Owner == owner && current.Holds > 0 && !current.expiredAt(now) {
+				current.Holds++
+				return current, current.Generation, nil
+			}
+			return nil, 0, ErrLockTaken
+		}
+
+		if !shared {
+			current.pruneShared(now)
+			if len(current.Shared) > 0 {
+				return nil, 0, ErrLockTaken
+			}
+		}
+	}
+
+	generation, err := next()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	holder := lockRecord{
+		Generation: generation,
+		Metadata:   *newMetadataAt(ttl, now),
+	}
+
+	if !shared {
+		holder.Owner = owner
+		if owner != "" && reentrant {
+			holder.Holds = 1
+		}
+		return &holder, generation, nil
+	}
+
+	if current == nil {
+		current = &lockRecord{}
+	}
+
+	current.pruneShared(now)
+	current.Shared = append(current.Shared, holder)
+
+	return current, generation, nil
+}
+
+// recordStore is the storage of the lock records of a single locker
+type recordStore interface {
+	// getRecord returns ErrLockNotExist if the lock is not held
+	getRecord(key string) (*lockRecord, error)
+	putRecord(key string, record *lockRecord) error
+	removeRecord(key string) error
+
+	// descendantRecords calls fn for every lock held below the key
+	descendantRecords(key string, fn func(key string, record *lockRecord)) error
+}
+
+// takeLock takes the lock on key in the given mode, on behalf of the
+// owner if it is not empty, unless the lock or a lock held on any of
+// its ancestors or descendants conflicts with it. Conflicting ancestor
+// and descendant locks whose holders have all expired are taken over,
+// the same way an expired lock on the key is
+func takeLock(store recordStore, key string, shared bool, owner string, reentrant bool, ttl time.Duration, now time.Time, next func() (int64, error)) (int64, error) {
+	related := make(map[string]*lockRecord)
+
+	for _, ancestor := range keyAncestors(key) {
+		record, err := store.getRecord(ancestor)
+		if err != nil {
+			if errors.Is(err, ErrLockNotExist) {
+				continue
+			}
+			return 0, err
+		}
+		related[ancestor] = record
+	}
+
+	err := store.descendantRecords(key, func(descendant string, record *lockRecord) {
+		related[descendant] = record
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []string
+	for k, record := range related {
+		if record.blocks(shared, now) {
+			return 0, ErrLockTaken
+		}
+
+		if _, exp := record.expiry(now); exp {
+			expired = append(expired, k)
+		}
+	}
+
+	current, err := store.getRecord(key)
+	if err != nil {
+		if !errors.Is(err, ErrLockNotExist) {
+			return 0, err
+		}
+		current = nil
+	}
+
+	record, gen, err := acquireRecord(current, shared, owner, reentrant, ttl, now, next)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, k := range expired {
+		err = store.removeRecord(k)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = store.putRecord(key, record)
+	if err != nil {
+		return 0, err
+	}
+
+	return gen, nil
+}
@@ -0,0 +1,240 @@
+package locker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisKeyPrefix     = "lockronomicon:lock:"
+	redisGenerationKey = "lockronomicon:generation"
+)
+
+const (
+	redisResultNotExist    = -1
+	redisResultGenMismatch = -2
+)
+
+// KEYS[1] - lock key, KEYS[2] - generation counter key
+// ARGV[1] - expected generation, ARGV[2] - current unix time
+var redisRefreshScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return -1
+end
+
+local record = cjson.decode(data)
+if record.generation ~= tonumber(ARGV[1]) then
+	return -2
+end
+
+record.generation = redis.call('INCR', KEYS[2])
+if record.ttl < 0 then
+	redis.call('SET', KEYS[1], cjson.encode(record))
+else
+	record.expires = tonumber(ARGV[2]) + record.ttl
+	redis.call('SET', KEYS[1], cjson.encode(record), 'PX', math.max(record.ttl * 1000, 1))
+end
+
+return record.generation
+`)
+
+// KEYS[1] - lock key
+// ARGV[1] - expected generation
+var redisReleaseScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return -1
+end
+
+local record = cjson.decode(data)
+if record.generation ~= tonumber(ARGV[1]) then
+	return -2
+end
+
+redis.call('DEL', KEYS[1])
+return 0
+`)
+
+// RedisLocker keeps locks as Redis string keys expiring together with the lock
+type RedisLocker struct {
+	client *redis.Client
+}
+
+func NewRedisLocker(addr string) (*RedisLocker, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+
+	err := client.Ping(context.Background()).Err()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisLocker{
+		client: client,
+	}, nil
+}
+
+func (r *RedisLocker) Close() error {
+	return r.client.Close()
+}
+
+func (r *RedisLocker) Lock(key string, ttl time.Duration) (int64, error) {
+	ctx := context.Background()
+
+	gen, err := r.client.Incr(ctx, redisGenerationKey).Result()
+	if err != nil {
+		return 0, ErrWriteMetadata
+	}
+
+	record := &lockRecord{
+		Generation: gen,
+		Metadata:   *NewMetadata(ttl),
+	}
+
+	data, err := record.Encode()
+	if err != nil {
+		return 0, ErrEncodeMetadata
+	}
+
+	ok, err := r.client.SetNX(ctx, redisKeyPrefix+key, data, redisExpiration(&record.Metadata)).Result()
+	if err != nil {
+		return 0, ErrWriteMetadata
+	}
+
+	if !ok {
+		return 0, ErrLockTaken
+	}
+
+	return gen, nil
+}
+
+func (r *RedisLocker) Refresh(key string, generation int64) (int64, error) {
+	res, err := redisRefreshScript.Run(
+		context.Background(),
+		r.client,
+		[]string{redisKeyPrefix + key, redisGenerationKey},
+		generation,
+		time.Now().Unix(),
+	).Int64()
+	if err != nil {
+		return 0, ErrWriteMetadata
+	}
+
+	switch res {
+	case redisResultNotExist:
+		return 0, ErrLockNotExist
+	case redisResultGenMismatch:
+		return 0, ErrGenNumberMismatch
+	}
+
+	return res, nil
+}
+
+func (r *RedisLocker) Release(key string, generation int64) error {
+	res, err := redisReleaseScript.Run(
+		context.Background(),
+		r.client,
+		[]string{redisKeyPrefix + key},
+		generation,
+	).Int64()
+	if err != nil {
+		return ErrRemoveLock
+	}
+
+	switch res {
+	case redisResultNotExist:
+		return ErrLockNotExist
+	case redisResultGenMismatch:
+		return ErrGenNumberMismatch
+	}
+
+	return nil
+}
+
+func (r *RedisLocker) Expired(key string) (int64, bool, error) {
+	data, err := r.client.Get(context.Background(), redisKeyPrefix+key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, false, ErrLockNotExist
+		}
+		return 0, false, ErrReadLock
+	}
+
+	record, err := parseLockRecord(data)
+	if err != nil {
+		return 0, false, ErrDecodeMetadata
+	}
+
+	return record.Generation, record.Expired(), nil
+}
+
+func (r *RedisLocker) Get(key string) (*LockInfo, error) {
+	data, err := r.client.Get(context.Background(), redisKeyPrefix+key).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrLockNotExist
+		}
+		return nil, ErrReadLock
+	}
+
+	record, err := parseLockRecord(data)
+	if err != nil {
+		return nil, ErrDecodeMetadata
+	}
+
+	return record.info(key), nil
+}
+
+// List scans the whole keyspace for the lock keys with the prefix, so that
+// they can be sorted and paged through
+func (r *RedisLocker) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	ctx := context.Background()
+
+	var keys []string
+	iter := r.client.Scan(ctx, 0, redisKeyPrefix+prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		key := strings.TrimPrefix(iter.Val(), redisKeyPrefix)
+		if !skipsInternalKey(prefix, key) {
+			keys = append(keys, key)
+		}
+	}
+	if iter.Err() != nil {
+		return nil, ErrReadLock
+	}
+
+	var locks []*LockInfo
+	for _, key := range pageKeys(keys, after, limit) {
+		info, err := r.Get(key)
+		if err != nil {
+			if errors.Is(err, ErrLockNotExist) {
+				// released or expired since the scan
+				continue
+			}
+			return nil, err
+		}
+		locks = append(locks, info)
+	}
+	return locks, nil
+}
+
+// redisExpiration returns the key expiration for the lock, zero
+// meaning no expiration; Redis rejects a zero PX so already expired
+// locks are kept for a single millisecond
+func redisExpiration(md *Metadata) time.Duration {
+	if md.TTL < 0 {
+		return 0
+	}
+
+	if md.TTL == 0 {
+		return time.Millisecond
+	}
+
+	return time.Duration(md.TTL) * time.Second
+}
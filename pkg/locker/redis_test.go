@@ -0,0 +1,258 @@
+package locker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func execRedisTest(t *testing.T, fn func(l *RedisLocker, srv *miniredis.Miniredis)) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer srv.Close()
+
+	locker, err := NewRedisLocker(srv.Addr())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer locker.Close()
+
+	fn(locker, srv)
+}
+
+func TestRedisLockPreventsConsecutiveLock(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, _ *miniredis.Miniredis) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("redis locker expected lock taken error")
+		}
+	})
+}
+
+func TestRedisReleaseAllowsConsecutiveLocks(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, _ *miniredis.Miniredis) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("redis locker release unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRedisReleaseFailsOnGenerationNumberMismatch(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, _ *miniredis.Miniredis) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn+10)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("redis locker expected generation number mismatch error")
+		}
+
+		err = l.Release("other.key", gn)
+		if !errors.Is(err, ErrLockNotExist) {
+			t.Errorf("redis locker expected lock not exist error")
+		}
+	})
+}
+
+func TestRedisRefreshReturnsValidNewGenerationNumber(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, srv *miniredis.Miniredis) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+
+		srv.FastForward(50 * time.Second)
+
+		gn2, err := l.Refresh(key, gn)
+		if err != nil {
+			t.Errorf("redis locker refresh unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("redis locker refresh returned non-increasing generation number: %d", gn2)
+		}
+
+		if ttl := srv.TTL(redisKeyPrefix + key); ttl != 100*time.Second {
+			t.Errorf("redis locker refresh expected key TTL to be reset, got %v", ttl)
+		}
+
+		_, err = l.Refresh(key, gn)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("redis locker expected generation number mismatch error")
+		}
+	})
+}
+
+func TestRedisRefreshHandlesNeverExpiringLock(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, srv *miniredis.Miniredis) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, -1*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Refresh(key, gn)
+		if err != nil {
+			t.Errorf("redis locker refresh unexpected error: %v", err)
+		}
+
+		if ttl := srv.TTL(redisKeyPrefix + key); ttl != 0 {
+			t.Errorf("redis locker expected key without TTL, got %v", ttl)
+		}
+	})
+}
+
+func TestRedisLockExpires(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, srv *miniredis.Miniredis) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 10*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+
+		_, exp, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("redis locker expired unexpected error: %v", err)
+		}
+
+		if exp {
+			t.Errorf("expected lock to be non-expired")
+		}
+
+		srv.FastForward(11 * time.Second)
+
+		_, _, err = l.Expired(key)
+		if !errors.Is(err, ErrLockNotExist) {
+			t.Errorf("redis locker expected lock not exist error")
+		}
+
+		_, err = l.Lock(key, 10*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+	})
+}
+
+func TestRedisGetDescribesLock(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, srv *miniredis.Miniredis) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("redis locker lock unexpected error: %v", err)
+		}
+
+		info, err := l.Get(key)
+		if err != nil {
+			t.Fatalf("redis locker get unexpected error: %v", err)
+		}
+
+		if len(info.Holders) != 1 || info.Holders[0].Generation != gn || info.Holders[0].TTL != 100 {
+			t.Errorf("redis locker unexpected lock description: %+v", info)
+		}
+
+		_, err = l.Get("other.key")
+		if !errors.Is(err, ErrLockNotExist) {
+			t.Errorf("redis locker expected lock not exist error")
+		}
+	})
+}
+
+func TestRedisListPagesThroughLocks(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, srv *miniredis.Miniredis) {
+		for _, key := range []string{"db.users", "db.orders", "cache.sessions", "db.accounts"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("redis locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("db.", "", 2)
+		if err != nil {
+			t.Errorf("redis locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "db.accounts" || locks[1].Key != "db.orders" {
+			t.Fatalf("redis locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("db.", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("redis locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "db.users" || len(locks[0].Holders) != 1 {
+			t.Errorf("redis locker unexpected second page: %+v", locks)
+		}
+	})
+}
+
+func TestRedisListSkipsInternalLocks(t *testing.T) {
+	execRedisTest(t, func(l *RedisLocker, srv *miniredis.Miniredis) {
+		for _, key := range []string{"a", "@semaphore.db@1.0", "0", "@lfs.repo@1", "Z"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("redis locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("", "", 2)
+		if err != nil {
+			t.Errorf("redis locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "0" || locks[1].Key != "Z" {
+			t.Fatalf("redis locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("redis locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "a" {
+			t.Errorf("redis locker unexpected second page: %+v", locks)
+		}
+
+		locks, err = l.List(InternalKeyPrefix, "", 10)
+		if err != nil {
+			t.Errorf("redis locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "@lfs.repo@1" || locks[1].Key != "@semaphore.db@1.0" {
+			t.Errorf("redis locker unexpected internal locks: %+v", locks)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package locker
+
+import "database/sql"
+
+// applyMigrations runs the migrations that have not been applied yet,
+// the number of applied migrations is tracked in the
+// lockronomicon_migrations table
+func applyMigrations(tx *sql.Tx, migrations []string) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS lockronomicon_migrations (version integer NOT NULL)`)
+	if err != nil {
+		return err
+	}
+
+	var version int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM lockronomicon_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		_, err = tx.Exec(migrations[i])
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO lockronomicon_migrations (version) VALUES ($1)`, i+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sqlRow is either *sql.Row or *sql.Rows
+type sqlRow interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLock scans a row of key, generation, ttl and the unix times of
+// expiry and acquisition, with a NULL expiry for immortal locks
+func scanLock(row sqlRow) (*LockInfo, error) {
+	var info LockInfo
+	var holder Holder
+	var expires, acquired sql.NullInt64
+
+	err := row.Scan(&info.Key, &holder.Generation, &holder.TTL, &expires, &acquired)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLockNotExist
+		}
+		return nil, ErrReadLock
+	}
+
+	holder.Expires = -1
+	if expires.Valid {
+		holder.Expires = expires.Int64
+	}
+	holder.Acquired = acquired.Int64
+
+	info.Holders = []Holder{holder}
+	return &info, nil
+}
+
+// scanLocks scans every row with scanLock
+func scanLocks(rows *sql.Rows) ([]*LockInfo, error) {
+	defer rows.Close()
+
+	var locks []*LockInfo
+	for rows.Next() {
+		info, err := scanLock(rows)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, info)
+	}
+
+	if rows.Err() != nil {
+		return nil, ErrReadLock
+	}
+
+	return locks, nil
+}
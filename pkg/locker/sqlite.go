@@ -0,0 +1,254 @@
+package locker
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order on startup
+var sqliteMigrations = []string{
+	`CREATE TABLE lockronomicon_generation (
+		id    integer PRIMARY KEY CHECK (id = 1),
+		value integer NOT NULL
+	)`,
+	`INSERT INTO lockronomicon_generation (id, value) VALUES (1, 0)`,
+	`CREATE TABLE lockronomicon_locks (
+		key        text PRIMARY KEY,
+		generation integer NOT NULL,
+		ttl        integer NOT NULL,
+		expires_at integer
+	)`,
+	`ALTER TABLE lockronomicon_locks ADD COLUMN acquired_at integer`,
+}
+
+// SQLiteLocker keeps every lock as a row of a single SQLite database file,
+// generation numbers are compared and set within a single transaction
+type SQLiteLocker struct {
+	db *sql.DB
+}
+
+func NewSQLiteLocker(path string) (*SQLiteLocker, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer at a time
+	db.SetMaxOpenConns(1)
+
+	err = migrateSQLite(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteLocker{
+		db: db,
+	}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = applyMigrations(tx, sqliteMigrations)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteLocker) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteLocker) Lock(key string, ttl time.Duration) (int64, error) {
+	md := NewMetadata(ttl)
+
+	var gen int64
+	err := s.update(func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM lockronomicon_locks WHERE key = $1)`, key).Scan(&exists)
+		if err != nil {
+			return ErrReadLock
+		}
+
+		if exists {
+			return ErrLockTaken
+		}
+
+		gen, err = sqliteNextGeneration(tx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO lockronomicon_locks (key, generation, ttl, expires_at, acquired_at) VALUES ($1, $2, $3, $4, $5)`,
+			key, gen, md.TTL, sqliteExpiresAt(md), md.Acquired,
+		)
+		if err != nil {
+			return ErrWriteMetadata
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return gen, nil
+}
+
+func (s *SQLiteLocker) Refresh(key string, generation int64) (int64, error) {
+	var gen int64
+	err := s.update(func(tx *sql.Tx) error {
+		md, err := sqliteCurrentLock(tx, key, generation)
+		if err != nil {
+			return err
+		}
+
+		gen, err = sqliteNextGeneration(tx)
+		if err != nil {
+			return err
+		}
+
+		md = NewMetadata(time.Duration(md.TTL) * time.Second)
+		_, err = tx.Exec(
+			`UPDATE lockronomicon_locks SET generation = $1, expires_at = $2 WHERE key = $3 AND generation = $4`,
+			gen, sqliteExpiresAt(md), key, generation,
+		)
+		if err != nil {
+			return ErrWriteMetadata
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return gen, nil
+}
+
+func (s *SQLiteLocker) Release(key string, generation int64) error {
+	return s.update(func(tx *sql.Tx) error {
+		_, err := sqliteCurrentLock(tx, key, generation)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM lockronomicon_locks WHERE key = $1 AND generation = $2`, key, generation)
+		if err != nil {
+			return ErrRemoveLock
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteLocker) Expired(key string) (int64, bool, error) {
+	var gen int64
+	var expiresAt sql.NullInt64
+
+	err := s.db.QueryRow(`SELECT generation, expires_at FROM lockronomicon_locks WHERE key = $1`, key).Scan(&gen, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, ErrLockNotExist
+		}
+		return 0, false, ErrReadLock
+	}
+
+	md := &Metadata{Expires: -1}
+	if expiresAt.Valid {
+		md.Expires = expiresAt.Int64
+	}
+
+	return gen, md.Expired(), nil
+}
+
+func (s *SQLiteLocker) Get(key string) (*LockInfo, error) {
+	return scanLock(s.db.QueryRow(
+		`SELECT key, generation, ttl, expires_at, acquired_at FROM lockronomicon_locks WHERE key = $1`,
+		key,
+	))
+}
+
+func (s *SQLiteLocker) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	rows, err := s.db.Query(`
+		SELECT key, generation, ttl, expires_at, acquired_at
+		FROM lockronomicon_locks
+		WHERE substr(key, 1, length($1)) = $1 AND key > $2
+			AND (substr($1, 1, 1) = '`+InternalKeyPrefix+`' OR substr(key, 1, 1) <> '`+InternalKeyPrefix+`')
+		ORDER BY key
+		LIMIT $3`,
+		prefix, after, limit,
+	)
+	if err != nil {
+		return nil, ErrReadLock
+	}
+
+	return scanLocks(rows)
+}
+
+// update runs fn in a transaction which is committed only if fn succeeds
+func (s *SQLiteLocker) update(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return ErrReadLock
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	if tx.Commit() != nil {
+		return ErrWriteMetadata
+	}
+
+	return nil
+}
+
+// sqliteCurrentLock returns the metadata of the lock if it is
+// held with the given generation number
+func sqliteCurrentLock(tx *sql.Tx, key string, generation int64) (*Metadata, error) {
+	var gen int64
+	var md Metadata
+
+	err := tx.QueryRow(`SELECT generation, ttl FROM lockronomicon_locks WHERE key = $1`, key).Scan(&gen, &md.TTL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrLockNotExist
+		}
+		return nil, ErrReadLock
+	}
+
+	if generation != gen {
+		return nil, ErrGenNumberMismatch
+	}
+
+	return &md, nil
+}
+
+func sqliteNextGeneration(tx *sql.Tx) (int64, error) {
+	var gen int64
+	err := tx.QueryRow(`UPDATE lockronomicon_generation SET value = value + 1 WHERE id = 1 RETURNING value`).Scan(&gen)
+	if err != nil {
+		return 0, ErrWriteMetadata
+	}
+	return gen, nil
+}
+
+func sqliteExpiresAt(md *Metadata) sql.NullInt64 {
+	return sql.NullInt64{
+		Int64: md.Expires,
+		Valid: md.Expires != -1,
+	}
+}
@@ -0,0 +1,279 @@
+package locker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func execSQLiteTest(t *testing.T, fn func(l *SQLiteLocker)) {
+	dir, err := os.MkdirTemp("", "locker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	locker, err := NewSQLiteLocker(filepath.Join(dir, "locks.db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer locker.Close()
+
+	fn(locker)
+}
+
+func TestSQLiteLockPreventsConsecutiveLock(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		key := "test.key"
+
+		_, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("sqlite locker lock unexpected error: %v", err)
+		}
+
+		_, err = l.Lock(key, 100*time.Second)
+		if !errors.Is(err, ErrLockTaken) {
+			t.Errorf("sqlite locker expected lock taken error")
+		}
+	})
+}
+
+func TestSQLiteReleaseAllowsConsecutiveLocks(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("sqlite locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn)
+		if err != nil {
+			t.Errorf("sqlite locker release unexpected error: %v", err)
+		}
+
+		gn2, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("sqlite locker lock unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("sqlite locker lock returned non-increasing generation number: %d", gn2)
+		}
+	})
+}
+
+func TestSQLiteReleaseFailsOnGenerationNumberMismatch(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("sqlite locker lock unexpected error: %v", err)
+		}
+
+		err = l.Release(key, gn+10)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("sqlite locker expected generation number mismatch error")
+		}
+	})
+}
+
+func TestSQLiteRefreshReturnsValidNewGenerationNumber(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 100*time.Second)
+		if err != nil {
+			t.Errorf("sqlite locker lock unexpected error: %v", err)
+		}
+
+		gn2, err := l.Refresh(key, gn)
+		if err != nil {
+			t.Errorf("sqlite locker refresh unexpected error: %v", err)
+		}
+
+		if gn2 <= gn {
+			t.Errorf("sqlite locker refresh returned non-increasing generation number: %d", gn2)
+		}
+
+		_, err = l.Refresh(key, gn)
+		if !errors.Is(err, ErrGenNumberMismatch) {
+			t.Errorf("sqlite locker expected generation number mismatch error")
+		}
+	})
+}
+
+func TestSQLiteRefreshFailsOnNonExistingLock(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		_, err := l.Refresh("test.key", 1)
+		if !errors.Is(err, ErrLockNotExist) {
+			t.Errorf("sqlite locker expected lock not exist error")
+		}
+	})
+}
+
+func TestSQLiteRecognizesExpiredLock(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, 0)
+		if err != nil {
+			t.Errorf("sqlite locker lock unexpected error: %v", err)
+		}
+
+		gn2, exp, err := l.Expired(key)
+		if err != nil {
+			t.Errorf("sqlite locker expired unexpected error: %v", err)
+		}
+
+		if !exp {
+			t.Errorf("expected lock to be expired")
+		}
+
+		if gn != gn2 {
+			t.Errorf("expected generation number %d, received %d", gn, gn2)
+		}
+	})
+}
+
+func TestSQLitePersistsLocksAcrossReopen(t *testing.T) {
+	dir, err := os.MkdirTemp("", "locker")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "locks.db")
+	key := "test.key"
+
+	l, err := NewSQLiteLocker(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gn, err := l.Lock(key, -1*time.Second)
+	if err != nil {
+		t.Errorf("sqlite locker lock unexpected error: %v", err)
+	}
+	l.Close()
+
+	l, err = NewSQLiteLocker(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+
+	err = l.Release(key, gn)
+	if err != nil {
+		t.Errorf("sqlite locker release unexpected error: %v", err)
+	}
+}
+
+func TestSQLiteUsesWALJournal(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		var mode string
+		err := l.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode)
+		if err != nil {
+			t.Errorf("sqlite locker journal mode unexpected error: %v", err)
+		}
+
+		if mode != "wal" {
+			t.Errorf("expected journal mode wal, received %s", mode)
+		}
+	})
+}
+
+func TestSQLiteGetDescribesLock(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		key := "test.key"
+
+		gn, err := l.Lock(key, -1)
+		if err != nil {
+			t.Errorf("sqlite locker lock unexpected error: %v", err)
+		}
+
+		info, err := l.Get(key)
+		if err != nil {
+			t.Fatalf("sqlite locker get unexpected error: %v", err)
+		}
+
+		if len(info.Holders) != 1 {
+			t.Fatalf("sqlite locker expected a single holder, received %+v", info)
+		}
+
+		h := info.Holders[0]
+		if h.Generation != gn || h.Expires != -1 || h.Acquired == 0 {
+			t.Errorf("sqlite locker unexpected holder: %+v", h)
+		}
+	})
+}
+
+func TestSQLiteListPagesThroughLocks(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		for _, key := range []string{"db.users", "db.orders", "cache.sessions", "db.accounts"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("sqlite locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("db.", "", 2)
+		if err != nil {
+			t.Errorf("sqlite locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "db.accounts" || locks[1].Key != "db.orders" {
+			t.Fatalf("sqlite locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("db.", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("sqlite locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "db.users" || len(locks[0].Holders) != 1 {
+			t.Errorf("sqlite locker unexpected second page: %+v", locks)
+		}
+	})
+}
+
+func TestSQLiteListSkipsInternalLocks(t *testing.T) {
+	execSQLiteTest(t, func(l *SQLiteLocker) {
+		for _, key := range []string{"a", "@semaphore.db@1.0", "0", "@lfs.repo@1", "Z"} {
+			_, err := l.Lock(key, 100*time.Second)
+			if err != nil {
+				t.Errorf("sqlite locker lock unexpected error: %v", err)
+			}
+		}
+
+		locks, err := l.List("", "", 2)
+		if err != nil {
+			t.Errorf("sqlite locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "0" || locks[1].Key != "Z" {
+			t.Fatalf("sqlite locker unexpected first page: %+v", locks)
+		}
+
+		locks, err = l.List("", locks[1].Key, 2)
+		if err != nil {
+			t.Errorf("sqlite locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 1 || locks[0].Key != "a" {
+			t.Errorf("sqlite locker unexpected second page: %+v", locks)
+		}
+
+		locks, err = l.List(InternalKeyPrefix, "", 10)
+		if err != nil {
+			t.Errorf("sqlite locker list unexpected error: %v", err)
+		}
+
+		if len(locks) != 2 || locks[0].Key != "@lfs.repo@1" || locks[1].Key != "@semaphore.db@1.0" {
+			t.Errorf("sqlite locker unexpected internal locks: %+v", locks)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package locker
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Table is an in-memory set of locks. It is not safe for concurrent use
+// and is given the time and the generation number source of every change,
+// so that replicas applying the same changes end up in the same state
+type Table struct {
+	locks map[string]*lockRecord
+
+	// nested counts the hierarchical keys, so that looking for
+	// descendants can be skipped while there are none
+	nested int
+}
+
+func NewTable() *Table {
+	return &Table{
+		locks: make(map[string]*lockRecord),
+	}
+}
+
+// Lock takes the lock on key in the shared or the exclusive mode, on
+// behalf of the owner if it is not empty, and returns the generation
+// number of the new holder. The owner takes its lock again only if the
+// lock is reentrant
+func (t *Table) Lock(key string, shared bool, owner string, reentrant bool, ttl time.Duration, now time.Time, next func() (int64, error)) (int64, error) {
+	return takeLock(t, key, shared, owner, reentrant, ttl, now, next)
+}
+
+// Refresh renews the hold of the holder with the given
+// generation number and returns its new generation number
+func (t *Table) Refresh(key string, generation int64, now time.Time, next func() (int64, error)) (int64, error) {
+	lock, ok := t.locks[key]
+	if !ok {
+		return 0, ErrLockNotExist
+	}
+
+	return lock.refresh(generation, now, next)
+}
+
+// Release removes the holder with the given generation number
+func (t *Table) Release(key string, generation int64, now time.Time) error {
+	lock, ok := t.locks[key]
+	if !ok {
+		return ErrLockNotExist
+	}
+
+	released, err := lock.release(generation, now)
+	if err != nil {
+		return err
+	}
+
+	if released {
+		t.removeRecord(key)
+	}
+
+	return nil
+}
+
+// Swap hands the exclusive lock held with the given generation number
+// over to the owner and returns the generation number of the new holder
+func (t *Table) Swap(key string, generation int64, owner string, ttl time.Duration, now time.Time, next func() (int64, error)) (int64, error) {
+	lock, ok := t.locks[key]
+	if !ok {
+		return 0, ErrLockNotExist
+	}
+
+	return lock.swap(generation, owner, ttl, now, next)
+}
+
+// Expired returns the generation number of the holder expiring last
+// and whether every holder of the lock has expired at the given time
+func (t *Table) Expired(key string, now time.Time) (int64, bool, error) {
+	lock, ok := t.locks[key]
+	if !ok {
+		return 0, false, ErrLockNotExist
+	}
+
+	gen, expired := lock.expiry(now)
+	return gen, expired, nil
+}
+
+// Get returns the description of the lock
+func (t *Table) Get(key string) (*LockInfo, error) {
+	lock, ok := t.locks[key]
+	if !ok {
+		return nil, ErrLockNotExist
+	}
+
+	return lock.info(key), nil
+}
+
+// List returns the locks with keys starting with the prefix
+func (t *Table) List(prefix string, after string, limit int) ([]*LockInfo, error) {
+	var keys []string
+	for key := range t.locks {
+		if strings.HasPrefix(key, prefix) && !skipsInternalKey(prefix, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	var locks []*LockInfo
+	for _, key := range pageKeys(keys, after, limit) {
+		locks = append(locks, t.locks[key].info(key))
+	}
+	return locks, nil
+}
+
+// Clone returns a deep copy of the table
+func (t *Table) Clone() *Table {
+	clone := NewTable()
+	for key, lock := range t.locks {
+		l := *lock
+		l.Shared = append([]lockRecord(nil), lock.Shared...)
+		clone.putRecord(key, &l)
+	}
+	return clone
+}
+
+func (t *Table) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.locks)
+}
+
+func (t *Table) UnmarshalJSON(data []byte) error {
+	locks := make(map[string]*lockRecord)
+	if err := json.Unmarshal(data, &locks); err != nil {
+		return err
+	}
+
+	*t = *NewTable()
+	for key, lock := range locks {
+		t.putRecord(key, lock)
+	}
+
+	return nil
+}
+
+func (t *Table) getRecord(key string) (*lockRecord, error) {
+	lock, ok := t.locks[key]
+	if !ok {
+		return nil, ErrLockNotExist
+	}
+	return lock, nil
+}
+
+func (t *Table) putRecord(key string, record *lockRecord) error {
+	if _, ok := t.locks[key]; !ok && strings.Contains(key, KeyDelimiter) {
+		t.nested++
+	}
+	t.locks[key] = record
+	return nil
+}
+
+func (t *Table) removeRecord(key string) error {
+	if _, ok := t.locks[key]; ok && strings.Contains(key, KeyDelimiter) {
+		t.nested--
+	}
+	delete(t.locks, key)
+	return nil
+}
+
+func (t *Table) descendantRecords(key string, fn func(key string, record *lockRecord)) error {
+	if t.nested == 0 {
+		return nil
+	}
+
+	for k, lock := range t.locks {
+		if isDescendant(k, key) {
+			fn(k, lock)
+		}
+	}
+	return nil
+}